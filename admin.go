@@ -0,0 +1,1023 @@
+// admin.go
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"html/template"
+	"image"
+	_ "image/jpeg" // Cover image formats
+	_ "image/png"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/cobra"
+)
+
+//go:embed admin
+var adminFiles embed.FS
+
+// Route the admin UI is served under, and its stylesheet and script
+const (
+	adminPath      = "/admin"
+	adminAssetPath = "/admin/static/"
+)
+
+// Largest cover image accepted, and the smallest size Apple Podcasts accepts
+const (
+	maxCoverSize      = 10 << 20
+	minCoverDimension = 1400
+)
+
+// Failed sign-ins a client address gets before it has to wait, and the longest wait.
+// The wait doubles with every further failure.
+const (
+	adminFreeSignIns   = 5
+	adminSignInMaxWait = 15 * time.Minute
+)
+
+// Cookie carrying the notice shown after a form is submitted
+const adminFlashCookie = "chopchop_admin_flash"
+
+// Entry formats of the editor
+const (
+	entryFormatMarkdown = "markdown"
+	entryFormatHTML     = "html"
+)
+
+// adminUI serves the web admin at /admin. It signs users in with HTTP Basic credentials
+// from the config and changes feeds through the same operations as the commands.
+type adminUI struct {
+	routes  *feedRoutes
+	pages   map[string]*template.Template
+	assets  map[string]*themeAsset
+	csrfKey []byte
+}
+
+// AdminPage is the data every admin page is rendered with
+type AdminPage struct {
+	Title  string
+	User   string
+	CSRF   string
+	Notice string
+	Error  string
+	Data   any
+}
+
+// AdminDashboard lists what can be managed, with the latest logged problems
+type AdminDashboard struct {
+	Feeds    []AdminFeedRow
+	Podcasts []AdminPodcastRow
+	Errors   []LoggedError
+}
+
+// AdminFeedRow is a feed on the dashboard
+type AdminFeedRow struct {
+	Name       string
+	Title      string
+	Kind       string // Remote, Composite or empty for regular feeds
+	Entries    int
+	Updated    time.Time
+	Restricted bool
+}
+
+// AdminPodcastRow is a podcast on the dashboard
+type AdminPodcastRow struct {
+	Name       string
+	Title      string
+	URLPath    string // Where the podcast is served
+	Episodes   int
+	Updated    time.Time
+	Restricted bool
+	Scannable  bool // Has an audio directory to rescan
+}
+
+// AdminFeedForm is the page that creates a feed or edits one and lists its entries
+type AdminFeedForm struct {
+	New      bool
+	Name     string
+	Feed     Feed
+	Editable bool // Entries can be added and edited, false for remote and composite feeds
+	Remote   bool
+	Entries  []AdminEntryRow
+}
+
+// AdminEntryRow is an entry of a feed, with its index for the edit and delete routes and
+// the key they check it against
+type AdminEntryRow struct {
+	Index   int
+	Key     string
+	Title   string
+	Link    string
+	Created time.Time
+}
+
+// AdminEntryForm is the editor of an entry
+type AdminEntryForm struct {
+	New       bool
+	FeedName  string
+	FeedTitle string
+	Index     int
+	Key       string
+	Item      Item
+	Format    string
+	Body      string
+}
+
+// AdminPodcastForm edits the metadata of a podcast
+type AdminPodcastForm struct {
+	Name       string
+	URLPath    string
+	Podcast    Podcast
+	Categories string
+	Episodes   []AdminEpisodeRow
+	Coverable  bool // Has an audio directory the cover can be stored in
+}
+
+// AdminEpisodeRow is an episode on the podcast page
+type AdminEpisodeRow struct {
+	Title     string
+	Published time.Time
+	Duration  string
+	FileSize  int64
+}
+
+// newAdminUI parses the admin templates embedded in the binary
+func newAdminUI(routes *feedRoutes) (*adminUI, error) {
+	files, _ := fs.Sub(adminFiles, "admin")
+	assets, err := readThemeFiles(files)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &adminUI{
+		routes:  routes,
+		pages:   make(map[string]*template.Template),
+		assets:  make(map[string]*themeAsset),
+		csrfKey: []byte(randomHex(32)),
+	}
+	for name, asset := range assets {
+		if filepath.Ext(name) == ".html" {
+			continue
+		}
+		a.assets[name] = asset
+		a.assets[asset.hashedName] = asset
+	}
+
+	funcs := template.FuncMap{
+		"asset": func(name string) string {
+			if asset, exists := a.assets[name]; exists {
+				return adminAssetPath + asset.hashedName
+			}
+			return adminAssetPath + name
+		},
+		"date":     func(t time.Time) string { return t.Local().Format("2006-01-02 15:04") },
+		"filesize": formatFileSize,
+	}
+	layout := string(assets["layout.html"].data)
+	for _, page := range []string{"dashboard.html", "feed.html", "entry.html", "podcast.html"} {
+		tmpl, err := template.New("layout.html").Funcs(funcs).Parse(layout)
+		if err == nil {
+			_, err = tmpl.Parse(string(assets[page].data))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid admin template %s: %v", page, err)
+		}
+		a.pages[page] = tmpl
+	}
+	return a, nil
+}
+
+// register adds the admin routes to the server's router
+func (a *adminUI) register(r *mux.Router) {
+	handle := func(path string, handler http.HandlerFunc, methods ...string) {
+		r.Handle(adminPath+path, a.routes.limits.limitRequests(a.authenticate(handler))).Methods(methods...)
+	}
+
+	handle("", a.dashboard, http.MethodGet)
+	handle("/", a.dashboard, http.MethodGet)
+	handle("/preview", a.preview, http.MethodPost)
+	handle("/new-feed", a.newFeed, http.MethodGet)
+	handle("/feeds", a.createFeed, http.MethodPost)
+	handle("/feeds/{name}", a.editFeed, http.MethodGet)
+	handle("/feeds/{name}", a.updateFeed, http.MethodPost)
+	handle("/feeds/{name}/delete", a.deleteFeed, http.MethodPost)
+	handle("/feeds/{name}/refresh", a.refreshFeed, http.MethodPost)
+	handle("/feeds/{name}/entries/new", a.newEntry, http.MethodGet)
+	handle("/feeds/{name}/entries", a.createEntry, http.MethodPost)
+	handle("/feeds/{name}/entries/{index:[0-9]+}", a.editEntry, http.MethodGet)
+	handle("/feeds/{name}/entries/{index:[0-9]+}", a.updateEntry, http.MethodPost)
+	handle("/feeds/{name}/entries/{index:[0-9]+}/delete", a.deleteEntry, http.MethodPost)
+	handle("/podcasts/{name}", a.editPodcast, http.MethodGet)
+	handle("/podcasts/{name}", a.updatePodcast, http.MethodPost)
+	handle("/podcasts/{name}/refresh", a.refreshPodcast, http.MethodPost)
+	handle("/podcasts/{name}/cover", a.uploadCover, http.MethodPost)
+
+	r.PathPrefix(adminAssetPath).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveStaticAsset(w, r, a.assets, strings.TrimPrefix(r.URL.Path, adminAssetPath))
+	}))
+}
+
+// authenticate requires the credentials of an admin user, and a valid CSRF token on forms
+func (a *adminUI) authenticate(next http.Handler) http.Handler {
+	return requireAdminUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			r.Body = http.MaxBytesReader(w, r.Body, maxCoverSize+1<<20)
+			if !sameOrigin(r) || !hmac.Equal([]byte(r.FormValue("csrf")), []byte(a.csrfToken(adminUser(r)))) {
+				http.Error(w, "This form has expired, reload the page and try again", http.StatusForbidden)
+				return
+			}
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; img-src * data:; frame-ancestors 'none'")
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// adminSignIns counts recent failed sign-ins per client address, so passwords can't be
+// guessed as fast as bcrypt can check them
+var adminSignIns = struct {
+	sync.Mutex
+	failures  map[string]*signInFailures
+	lastSweep time.Time
+}{failures: make(map[string]*signInFailures)}
+
+// signInFailures are the recent failed sign-ins of one client address
+type signInFailures struct {
+	count int
+	last  time.Time
+	until time.Time // Sign-ins aren't checked before this
+}
+
+// signInWait returns how long a client address must wait before its next sign-in is checked
+func signInWait(host string) time.Duration {
+	adminSignIns.Lock()
+	defer adminSignIns.Unlock()
+
+	if f, exists := adminSignIns.failures[host]; exists {
+		return time.Until(f.until)
+	}
+	return 0
+}
+
+// recordSignIn forgets the failures of a client address after a successful sign-in, and
+// makes it wait longer after each failure past the free ones
+func recordSignIn(host string, success bool) {
+	adminSignIns.Lock()
+	defer adminSignIns.Unlock()
+
+	now := time.Now()
+	if now.Sub(adminSignIns.lastSweep) > time.Minute {
+		adminSignIns.lastSweep = now
+		for key, f := range adminSignIns.failures {
+			if now.Sub(f.last) > adminSignInMaxWait {
+				delete(adminSignIns.failures, key)
+			}
+		}
+	}
+
+	if success {
+		delete(adminSignIns.failures, host)
+		return
+	}
+
+	f, exists := adminSignIns.failures[host]
+	if !exists {
+		f = &signInFailures{}
+		adminSignIns.failures[host] = f
+	}
+	f.count++
+	f.last = now
+	if extra := f.count - adminFreeSignIns; extra > 0 {
+		f.until = now.Add(min(time.Second<<min(extra-1, 20), adminSignInMaxWait))
+	}
+}
+
+// requireAdminUser requires the HTTP Basic credentials of an admin user. The admin UI and
+// the upload API are off until a user is added. Clients that keep failing to sign in are
+// made to wait before their credentials are checked again.
+func requireAdminUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		configMu.RLock()
+		users := config.AdminUsers
+		configMu.RUnlock()
+		if len(users) == 0 {
+			http.Error(w, "The admin UI is disabled. Add a user with 'chopchoprss add-admin-user' and restart the server.", http.StatusNotFound)
+			return
+		}
+
+		username, password, ok := r.BasicAuth()
+		if ok {
+			host := remoteHost(r)
+			if wait := signInWait(host); wait > 0 {
+				tooManyRequests(w, wait, "admin_sign_in")
+				return
+			}
+			ok = credentialsValid(users, username, password)
+			recordSignIn(host, ok)
+			if !ok {
+				slog.Warn("Rejected admin sign-in", "username", username, "remote", host)
+			}
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="ChopChopRSS admin", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// csrfToken returns the token forms of a user carry. It changes when the server restarts.
+func (a *adminUI) csrfToken(username string) string {
+	mac := hmac.New(sha256.New, a.csrfKey)
+	mac.Write([]byte(username))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sameOrigin reports whether a form was submitted from this server. Browsers that send no
+// Origin header are let through; the CSRF token still protects them.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// render writes an admin page, with the notice left by the previous form
+func (a *adminUI) render(w http.ResponseWriter, r *http.Request, status int, name string, page AdminPage) {
+	page.User, _, _ = r.BasicAuth()
+	page.CSRF = a.csrfToken(page.User)
+	if cookie, err := r.Cookie(adminFlashCookie); err == nil && page.Notice == "" && page.Error == "" {
+		if message, err := url.QueryUnescape(cookie.Value); err == nil {
+			if text, isError := strings.CutPrefix(message, "error:"); isError {
+				page.Error = text
+			} else {
+				page.Notice = message
+			}
+		}
+		http.SetCookie(w, &http.Cookie{Name: adminFlashCookie, Path: adminPath, MaxAge: -1})
+	}
+
+	var buf bytes.Buffer
+	if err := a.pages[name].Execute(&buf, page); err != nil {
+		slog.Error("Failed to render admin page", "page", name, "error", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// redirect sends the browser to an admin page after a form, with a notice to show there
+func (a *adminUI) redirect(w http.ResponseWriter, r *http.Request, path, notice string, err error) {
+	if err != nil {
+		notice = "error:" + err.Error()
+	}
+	if notice != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     adminFlashCookie,
+			Value:    url.QueryEscape(notice),
+			Path:     adminPath,
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+	http.Redirect(w, r, adminPath+path, http.StatusSeeOther)
+}
+
+// dashboard lists the feeds and podcasts, and the latest warnings and errors
+func (a *adminUI) dashboard(w http.ResponseWriter, r *http.Request) {
+	var data AdminDashboard
+
+	configMu.RLock()
+	for name, feed := range config.Feeds {
+		row := AdminFeedRow{Name: name, Title: feed.Title, Entries: len(feed.Items), Updated: feed.Updated, Restricted: restrictedFeed(feed)}
+		switch {
+		case feed.Remote != nil:
+			row.Kind = "Remote"
+		case feed.Composite != nil:
+			row.Kind = "Composite"
+			row.Entries = len(renderedItems(feed))
+		}
+		data.Feeds = append(data.Feeds, row)
+	}
+	for name, podcast := range config.Podcasts {
+		data.Podcasts = append(data.Podcasts, AdminPodcastRow{
+			Name:       name,
+			Title:      podcast.Title,
+			URLPath:    podcastURLPath(name, podcast),
+			Episodes:   len(podcast.Episodes),
+			Updated:    podcast.Updated,
+			Restricted: restrictedPodcast(podcast),
+			Scannable:  podcast.AudioDir != "",
+		})
+	}
+	configMu.RUnlock()
+
+	sort.Slice(data.Feeds, func(i, j int) bool { return data.Feeds[i].Name < data.Feeds[j].Name })
+	sort.Slice(data.Podcasts, func(i, j int) bool { return data.Podcasts[i].Name < data.Podcasts[j].Name })
+	data.Errors = recentErrors.list()
+
+	a.render(w, r, http.StatusOK, "dashboard.html", AdminPage{Title: "Dashboard", Data: data})
+}
+
+// newFeed shows the form that creates a feed
+func (a *adminUI) newFeed(w http.ResponseWriter, r *http.Request) {
+	a.render(w, r, http.StatusOK, "feed.html", AdminPage{Title: "New feed", Data: AdminFeedForm{New: true, Editable: true}})
+}
+
+// createFeed creates a feed from the new feed form
+func (a *adminUI) createFeed(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSpace(r.FormValue("name"))
+	feed := feedFromForm(r)
+
+	var err error
+	if feed.Title == "" {
+		err = fmt.Errorf("A feed needs a title")
+	} else {
+		updateConfig(func() {
+			if err = addFeed(name, feed); err == nil {
+				emitFeedEvent(eventFeedCreated, name, "feed")
+			}
+		})
+	}
+	if err != nil {
+		form := AdminFeedForm{New: true, Name: name, Feed: feed, Editable: true}
+		a.render(w, r, http.StatusBadRequest, "feed.html", AdminPage{Title: "New feed", Error: err.Error(), Data: form})
+		return
+	}
+
+	a.routes.rebuild()
+	slog.Info("Feed created in admin", "feed", name, "user", adminUser(r))
+	a.redirect(w, r, "/feeds/"+url.PathEscape(name), fmt.Sprintf("Feed '%s' created, it is served at /%s", name, name), nil)
+}
+
+// editFeed shows the details and entries of a feed
+func (a *adminUI) editFeed(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	configMu.RLock()
+	feed, exists := config.Feeds[name]
+	configMu.RUnlock()
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	a.render(w, r, http.StatusOK, "feed.html", AdminPage{Title: feed.Title, Data: adminFeedForm(name, feed)})
+}
+
+// updateFeed saves the details of a feed
+func (a *adminUI) updateFeed(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	details := feedFromForm(r)
+
+	var err error
+	var feed Feed
+	if details.Title == "" {
+		err = fmt.Errorf("A feed needs a title")
+	} else {
+		updateConfig(func() {
+			err = setFeedDetails(name, details)
+			feed = config.Feeds[name]
+		})
+	}
+	if err != nil {
+		configMu.RLock()
+		feed, exists := config.Feeds[name]
+		configMu.RUnlock()
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		form := adminFeedForm(name, feed)
+		form.Feed.Title, form.Feed.Description, form.Feed.Link = details.Title, details.Description, details.Link
+		form.Feed.Author, form.Feed.Email = details.Author, details.Email
+		a.render(w, r, http.StatusBadRequest, "feed.html", AdminPage{Title: feed.Title, Error: err.Error(), Data: form})
+		return
+	}
+
+	a.redirect(w, r, "/feeds/"+url.PathEscape(name), fmt.Sprintf("Feed '%s' saved", feed.Title), nil)
+}
+
+// deleteFeed deletes a feed and stops serving it
+func (a *adminUI) deleteFeed(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	var err error
+	updateConfig(func() {
+		if err = removeFeed(name); err == nil {
+			emitFeedEvent(eventFeedDeleted, name, "feed")
+		}
+	})
+	if err != nil {
+		a.redirect(w, r, "/", "", err)
+		return
+	}
+
+	a.routes.rebuild()
+	slog.Info("Feed deleted in admin", "feed", name, "user", adminUser(r))
+	a.redirect(w, r, "/", fmt.Sprintf("Feed '%s' deleted", name), nil)
+}
+
+// refreshFeed fetches a mirrored feed from its upstream now
+func (a *adminUI) refreshFeed(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	configMu.RLock()
+	feed, exists := config.Feeds[name]
+	configMu.RUnlock()
+	if !exists || feed.Remote == nil {
+		a.redirect(w, r, "/feeds/"+url.PathEscape(name), "", fmt.Errorf("Feed '%s' is not a remote feed", name))
+		return
+	}
+
+	if err := fetchAndMergeRemoteFeed(name, *feed.Remote); err != nil {
+		slog.Warn("Failed to fetch remote feed", "feed", name, "error", err)
+		a.redirect(w, r, "/feeds/"+url.PathEscape(name), "", fmt.Errorf("Failed to fetch remote feed: %v", err))
+		return
+	}
+	a.redirect(w, r, "/feeds/"+url.PathEscape(name), fmt.Sprintf("Feed '%s' refreshed", name), nil)
+}
+
+// newEntry shows the editor for a new entry
+func (a *adminUI) newEntry(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	configMu.RLock()
+	feed, exists := config.Feeds[name]
+	configMu.RUnlock()
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	form := AdminEntryForm{New: true, FeedName: name, FeedTitle: feed.Title, Format: entryFormatMarkdown}
+	a.render(w, r, http.StatusOK, "entry.html", AdminPage{Title: "New entry", Data: form})
+}
+
+// createEntry adds an entry from the editor to a feed
+func (a *adminUI) createEntry(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	form := entryFromForm(r)
+	form.New, form.FeedName = true, name
+
+	var err error
+	var item Item
+	if form.Item.Title == "" {
+		err = fmt.Errorf("An entry needs a title")
+	} else {
+		updateConfig(func() {
+			if item, err = addEntry(name, form.Item); err == nil {
+				emitItemEvents(name, []Item{item}, nil)
+			}
+		})
+	}
+	if err != nil {
+		form.FeedTitle = adminFeedTitle(name)
+		a.render(w, r, http.StatusBadRequest, "entry.html", AdminPage{Title: "New entry", Error: err.Error(), Data: form})
+		return
+	}
+
+	a.redirect(w, r, "/feeds/"+url.PathEscape(name), fmt.Sprintf("Entry '%s' published", item.Title), nil)
+}
+
+// editEntry shows the editor for an entry of a feed
+func (a *adminUI) editEntry(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	index, _ := strconv.Atoi(mux.Vars(r)["index"])
+	key := r.URL.Query().Get("key")
+	configMu.RLock()
+	feed, exists := config.Feeds[name]
+	err := checkEntry(name, index, key)
+	configMu.RUnlock()
+	if !exists || err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	item := feed.Items[index]
+	form := AdminEntryForm{FeedName: name, FeedTitle: feed.Title, Index: index, Key: key, Item: item, Format: entryFormatMarkdown, Body: item.Markdown}
+	if item.Markdown == "" && item.Content != "" {
+		// Entries created with the CLI keep their HTML or plain text as it is
+		form.Format, form.Body = entryFormatHTML, item.Content
+	}
+	a.render(w, r, http.StatusOK, "entry.html", AdminPage{Title: item.Title, Data: form})
+}
+
+// updateEntry saves an entry from the editor
+func (a *adminUI) updateEntry(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	index, _ := strconv.Atoi(mux.Vars(r)["index"])
+	form := entryFromForm(r)
+	form.FeedName, form.Index, form.Key = name, index, r.FormValue("key")
+
+	var err error
+	var item Item
+	if form.Item.Title == "" {
+		err = fmt.Errorf("An entry needs a title")
+	} else {
+		updateConfig(func() {
+			if err = checkEntry(name, index, form.Key); err != nil {
+				return
+			}
+			if item, err = updateEntry(name, index, form.Item); err == nil {
+				form.Key = entryKey(item)
+				emitItemEvents(name, nil, []Item{item})
+			}
+		})
+	}
+	if err != nil {
+		form.FeedTitle = adminFeedTitle(name)
+		a.render(w, r, http.StatusBadRequest, "entry.html", AdminPage{Title: form.Item.Title, Error: err.Error(), Data: form})
+		return
+	}
+
+	a.redirect(w, r, "/feeds/"+url.PathEscape(name), fmt.Sprintf("Entry '%s' saved", item.Title), nil)
+}
+
+// deleteEntry deletes an entry from a feed
+func (a *adminUI) deleteEntry(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	index, _ := strconv.Atoi(mux.Vars(r)["index"])
+	key := r.FormValue("key")
+
+	var err error
+	var deleted Item
+	updateConfig(func() {
+		if err = checkEntry(name, index, key); err != nil {
+			return
+		}
+		if deleted, err = removeEntry(name, index); err == nil {
+			emitEvent(WebhookPayload{Event: eventEntryDeleted, Feed: name, Entry: &deleted})
+		}
+	})
+	a.redirect(w, r, "/feeds/"+url.PathEscape(name), fmt.Sprintf("Entry '%s' deleted", deleted.Title), err)
+}
+
+// preview renders the editor's content the way feed pages show it
+func (a *adminUI) preview(w http.ResponseWriter, r *http.Request) {
+	content := r.FormValue("body")
+	if r.FormValue("format") != entryFormatHTML {
+		content = markdownToHTML(content)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, string(renderContent(content)))
+}
+
+// editPodcast shows the metadata and episodes of a podcast
+func (a *adminUI) editPodcast(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	configMu.RLock()
+	podcast, exists := config.Podcasts[name]
+	configMu.RUnlock()
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	a.render(w, r, http.StatusOK, "podcast.html", AdminPage{Title: podcast.Title, Data: adminPodcastForm(name, podcast)})
+}
+
+// updatePodcast saves the metadata of a podcast
+func (a *adminUI) updatePodcast(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	details := Podcast{
+		Title:       strings.TrimSpace(r.FormValue("title")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		Link:        strings.TrimSpace(r.FormValue("link")),
+		Author:      strings.TrimSpace(r.FormValue("author")),
+		Email:       strings.TrimSpace(r.FormValue("email")),
+		ImageURL:    strings.TrimSpace(r.FormValue("image")),
+		Language:    strings.TrimSpace(r.FormValue("language")),
+		Copyright:   strings.TrimSpace(r.FormValue("copyright")),
+		Explicit:    r.FormValue("explicit") != "",
+	}
+	for _, category := range strings.Split(r.FormValue("categories"), ",") {
+		if category = strings.TrimSpace(category); category != "" {
+			details.Categories = append(details.Categories, category)
+		}
+	}
+
+	var err error
+	if details.Title == "" {
+		err = fmt.Errorf("A podcast needs a title")
+	} else {
+		updateConfig(func() { err = setPodcastDetails(name, details) })
+	}
+	if err != nil {
+		configMu.RLock()
+		podcast, exists := config.Podcasts[name]
+		configMu.RUnlock()
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		form := adminPodcastForm(name, podcast)
+		details.AudioDir, details.BaseURL = podcast.AudioDir, podcast.BaseURL
+		form.Podcast, form.Categories = details, r.FormValue("categories")
+		a.render(w, r, http.StatusBadRequest, "podcast.html", AdminPage{Title: podcast.Title, Error: err.Error(), Data: form})
+		return
+	}
+
+	a.redirect(w, r, "/podcasts/"+url.PathEscape(name), fmt.Sprintf("Podcast '%s' saved", details.Title), nil)
+}
+
+// refreshPodcast rescans the audio directory of a podcast
+func (a *adminUI) refreshPodcast(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	newEpisodes, err := rescanPodcast(name)
+	if err != nil {
+		slog.Warn("Failed to refresh podcast", "podcast", name, "error", err)
+		a.redirect(w, r, "/podcasts/"+url.PathEscape(name), "", err)
+		return
+	}
+	a.redirect(w, r, "/podcasts/"+url.PathEscape(name), fmt.Sprintf("Podcast '%s' refreshed, %d new episodes", name, len(newEpisodes)), nil)
+}
+
+// uploadCover stores a new cover image for a podcast in its audio directory and points
+// the podcast's image at it
+func (a *adminUI) uploadCover(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	back := "/podcasts/" + url.PathEscape(name)
+
+	file, _, err := r.FormFile("cover")
+	if err != nil {
+		a.redirect(w, r, back, "", fmt.Errorf("Choose an image to upload"))
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxCoverSize+1))
+	if err != nil || len(data) > maxCoverSize {
+		a.redirect(w, r, back, "", fmt.Errorf("Cover images can be at most %d MB", maxCoverSize>>20))
+		return
+	}
+	cover, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		a.redirect(w, r, back, "", fmt.Errorf("Cover images must be JPEG or PNG"))
+		return
+	}
+
+	configMu.RLock()
+	podcast, exists := config.Podcasts[name]
+	configMu.RUnlock()
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+	if podcast.AudioDir == "" {
+		a.redirect(w, r, back, "", fmt.Errorf("Podcast '%s' has no audio directory to store a cover in, set an image URL instead", name))
+		return
+	}
+
+	fileName, err := saveCoverImage(podcast.AudioDir, data, format)
+	if err != nil {
+		slog.Warn("Failed to save cover image", "podcast", name, "error", err)
+		a.redirect(w, r, back, "", err)
+		return
+	}
+
+	imageURL := strings.TrimSuffix(podcast.BaseURL, "/") + "/artwork/" + fileName
+	updateConfig(func() {
+		details := config.Podcasts[name]
+		details.ImageURL = imageURL
+		err = setPodcastDetails(name, details)
+	})
+
+	notice := "Cover image uploaded"
+	if cover.Width != cover.Height || cover.Width < minCoverDimension {
+		notice += fmt.Sprintf(". It is %dx%d; podcast directories ask for square images of at least %dx%d", cover.Width, cover.Height, minCoverDimension, minCoverDimension)
+	}
+	a.redirect(w, r, back, notice, err)
+}
+
+// saveCoverImage writes a cover image to the .artwork directory of a podcast, named after
+// its content so podcast apps pick up a new cover. It returns the file name.
+func saveCoverImage(audioDir string, data []byte, format string) (string, error) {
+	ext := ".png"
+	if format == "jpeg" {
+		ext = ".jpg"
+	}
+	sum := sha256.Sum256(data)
+	fileName := "cover-" + hex.EncodeToString(sum[:])[:10] + ext
+
+	artworkDir := filepath.Join(audioDir, ".artwork")
+	if err := os.MkdirAll(artworkDir, 0755); err != nil {
+		return "", fmt.Errorf("Failed to save cover image: %v", err)
+	}
+	if err := writeFileAtomic(filepath.Join(artworkDir, fileName), data); err != nil {
+		return "", fmt.Errorf("Failed to save cover image: %v", err)
+	}
+	return fileName, nil
+}
+
+// writeFileAtomic writes a file through a temporary file in the same directory, so readers
+// never see it half written
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// feedFromForm reads the details of a feed from a form
+func feedFromForm(r *http.Request) Feed {
+	return Feed{
+		Title:       strings.TrimSpace(r.FormValue("title")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		Link:        strings.TrimSpace(r.FormValue("link")),
+		Author:      strings.TrimSpace(r.FormValue("author")),
+		Email:       strings.TrimSpace(r.FormValue("email")),
+	}
+}
+
+// entryFromForm reads an entry from the editor, rendering its Markdown
+func entryFromForm(r *http.Request) AdminEntryForm {
+	form := AdminEntryForm{
+		Item: Item{
+			Title:    strings.TrimSpace(r.FormValue("title")),
+			Link:     strings.TrimSpace(r.FormValue("link")),
+			ImageURL: strings.TrimSpace(r.FormValue("image")),
+		},
+		Format: r.FormValue("format"),
+		Body:   strings.ReplaceAll(r.FormValue("body"), "\r\n", "\n"),
+	}
+
+	if form.Format == entryFormatHTML {
+		form.Item.Content = form.Body
+	} else {
+		form.Format = entryFormatMarkdown
+		form.Item.Markdown = form.Body
+		form.Item.Content = markdownToHTML(form.Body)
+	}
+	form.Item.Description = form.Item.Content
+	return form
+}
+
+// adminFeedForm collects the page of an existing feed, newest entries first
+func adminFeedForm(name string, feed Feed) AdminFeedForm {
+	form := AdminFeedForm{
+		Name:     name,
+		Feed:     feed,
+		Editable: feed.Remote == nil && feed.Composite == nil,
+		Remote:   feed.Remote != nil,
+	}
+	for i := len(feed.Items) - 1; i >= 0; i-- {
+		item := feed.Items[i]
+		form.Entries = append(form.Entries, AdminEntryRow{Index: i, Key: entryKey(item), Title: item.Title, Link: item.Link, Created: item.Created})
+	}
+	return form
+}
+
+// entryKey identifies an entry of a feed by GUID or link, or else by when it was created,
+// so the editor can tell whether the entry at an index is still the one it was opened on
+func entryKey(item Item) string {
+	if key := itemKey(item); key != "" {
+		return key
+	}
+	return "created:" + item.Created.UTC().Format(time.RFC3339Nano)
+}
+
+// checkEntry reports an error unless the entry at index of a feed has key, since entries
+// before it may have been added or deleted meanwhile. Callers must hold configMu.
+func checkEntry(name string, index int, key string) error {
+	feed := config.Feeds[name]
+	if index < 0 || index >= len(feed.Items) || entryKey(feed.Items[index]) != key {
+		return fmt.Errorf("The entry was changed or deleted since the page was loaded, reload it and try again")
+	}
+	return nil
+}
+
+// adminPodcastForm collects the page of a podcast, newest episodes first
+func adminPodcastForm(name string, podcast Podcast) AdminPodcastForm {
+	form := AdminPodcastForm{
+		Name:       name,
+		URLPath:    podcastURLPath(name, podcast),
+		Podcast:    podcast,
+		Categories: strings.Join(podcast.Categories, ", "),
+		Coverable:  podcast.AudioDir != "",
+	}
+	for i := len(podcast.Episodes) - 1; i >= 0; i-- {
+		episode := podcast.Episodes[i]
+		form.Episodes = append(form.Episodes, AdminEpisodeRow{
+			Title:     html.UnescapeString(episode.Title),
+			Published: episode.Published,
+			Duration:  formatEpisodeDuration(episode.Duration),
+			FileSize:  episode.FileSize,
+		})
+	}
+	return form
+}
+
+// adminFeedTitle returns the title of a feed, for pages showing a form again
+func adminFeedTitle(name string) string {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return config.Feeds[name].Title
+}
+
+// adminUser returns the admin user a request was signed in as
+func adminUser(r *http.Request) string {
+	username, _, _ := r.BasicAuth()
+	return username
+}
+
+// formatFileSize formats a size in bytes for people, like 12.3 MB
+func formatFileSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.0f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", size)
+}
+
+// addAdminUser lets a user sign in to the web admin UI, or changes their password
+func addAdminUser(cmd *cobra.Command, args []string) {
+	username, _ := cmd.Flags().GetString("username")
+
+	if username == "" || strings.Contains(username, ":") {
+		fmt.Println("Usernames can't be empty or contain ':'")
+		return
+	}
+
+	password, err := passwordFlag(cmd)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	generated := password == ""
+	if generated {
+		password = randomHex(12)
+	}
+
+	users, replaced, err := upsertBasicUser(config.AdminUsers, username, password)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	config.AdminUsers = users
+	saveConfig()
+
+	if replaced {
+		fmt.Printf("Password updated for admin user '%s'\n", username)
+	} else {
+		fmt.Printf("Admin user '%s' added, sign in at %s\n", username, adminPath)
+	}
+	if generated {
+		fmt.Printf("Password: %s\n", password)
+	}
+}
+
+// removeAdminUser removes a user from the web admin UI
+func removeAdminUser(cmd *cobra.Command, args []string) {
+	username, _ := cmd.Flags().GetString("username")
+
+	for i, user := range config.AdminUsers {
+		if user.Username == username {
+			config.AdminUsers = append(config.AdminUsers[:i], config.AdminUsers[i+1:]...)
+			saveConfig()
+			fmt.Printf("Admin user '%s' removed\n", username)
+			return
+		}
+	}
+
+	fmt.Printf("Admin user '%s' does not exist\n", username)
+}
@@ -0,0 +1,106 @@
+// Behaviour of the admin UI: confirmation of destructive forms and the entry editor
+(function () {
+  "use strict";
+
+  document.querySelectorAll("form[data-confirm]").forEach(function (form) {
+    form.addEventListener("submit", function (event) {
+      if (!window.confirm(form.dataset.confirm)) {
+        event.preventDefault();
+      }
+    });
+  });
+
+  document.querySelectorAll("[data-editor]").forEach(setupEditor);
+
+  function setupEditor(editor) {
+    var form = editor.closest("form");
+    var body = editor.querySelector("[data-body]");
+    var format = editor.querySelector("[data-format]");
+    var preview = editor.querySelector("[data-preview]");
+    var timer = null;
+    var pending = null;
+
+    function updatePreview() {
+      if (pending) {
+        pending.abort();
+      }
+      pending = new AbortController();
+      var data = new URLSearchParams();
+      data.set("csrf", form.elements.csrf.value);
+      data.set("format", format.value);
+      data.set("body", body.value);
+      fetch("/admin/preview", { method: "POST", body: data, signal: pending.signal, credentials: "same-origin" })
+        .then(function (response) {
+          if (!response.ok) {
+            throw new Error("Preview failed (" + response.status + ")");
+          }
+          return response.text();
+        })
+        .then(function (html) {
+          // The server returns sanitized HTML, rendered like feed pages show it
+          preview.innerHTML = html;
+        })
+        .catch(function (err) {
+          if (err.name !== "AbortError") {
+            preview.textContent = err.message;
+          }
+        });
+    }
+
+    function schedulePreview() {
+      clearTimeout(timer);
+      timer = setTimeout(updatePreview, 300);
+    }
+
+    function showFormat() {
+      editor.classList.toggle("html", format.value === "html");
+    }
+
+    // wrap surrounds the selection with Markdown, selecting placeholder text when there is none
+    function wrap(before, after, placeholder) {
+      var start = body.selectionStart;
+      var end = body.selectionEnd;
+      var selected = body.value.slice(start, end) || placeholder;
+      body.setRangeText(before + selected + after, start, end, "end");
+      body.setSelectionRange(start + before.length, start + before.length + selected.length);
+    }
+
+    // prefixLines starts every selected line with Markdown, like "- " for a list
+    function prefixLines(prefix) {
+      var start = body.value.lastIndexOf("\n", body.selectionStart - 1) + 1;
+      var end = body.selectionEnd;
+      var lines = body.value.slice(start, end).split("\n").map(function (line) {
+        return prefix + line;
+      });
+      body.setRangeText(lines.join("\n"), start, end, "end");
+    }
+
+    var actions = {
+      bold: function () { wrap("**", "**", "bold text"); },
+      italic: function () { wrap("*", "*", "italic text"); },
+      heading: function () { prefixLines("## "); },
+      link: function () { wrap("[", "](https://)", "link text"); },
+      image: function () { wrap("![", "](https://)", "description"); },
+      list: function () { prefixLines("- "); },
+      quote: function () { prefixLines("> "); },
+      code: function () { wrap("`", "`", "code"); }
+    };
+
+    editor.querySelectorAll("[data-md]").forEach(function (button) {
+      button.addEventListener("click", function () {
+        body.focus();
+        actions[button.dataset.md]();
+        schedulePreview();
+      });
+    });
+
+    body.addEventListener("input", schedulePreview);
+    format.addEventListener("change", function () {
+      showFormat();
+      updatePreview();
+    });
+
+    showFormat();
+    updatePreview();
+  }
+})();
@@ -0,0 +1,482 @@
+// analytics.go
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Download is one counted episode download, as recorded in the download log
+type Download struct {
+	Time    time.Time `json:"time"`
+	Podcast string    `json:"podcast"`
+	File    string    `json:"file"`   // Episode file, relative to the audio directory
+	Client  string    `json:"client"` // Hash of the IP address and User-Agent
+	App     string    `json:"app"`
+}
+
+// DownloadReport summarizes the downloads of a podcast
+type DownloadReport struct {
+	Podcast   string         `json:"podcast"`
+	Downloads int            `json:"downloads"`
+	Episodes  []EpisodeCount `json:"episodes"`
+	Days      []DayCount     `json:"days"`
+	Apps      []AppCount     `json:"apps"`
+}
+
+// EpisodeCount is the number of downloads of one episode
+type EpisodeCount struct {
+	Title     string `json:"title"`
+	File      string `json:"file"`
+	Downloads int    `json:"downloads"`
+}
+
+// DayCount is the number of downloads on one day
+type DayCount struct {
+	Day       string `json:"day"`
+	Downloads int    `json:"downloads"`
+}
+
+// AppCount is the number of downloads made with one client app
+type AppCount struct {
+	App       string `json:"app"`
+	Downloads int    `json:"downloads"`
+}
+
+// Repeated requests from the same client for the same episode within this window count once
+const downloadWindow = 24 * time.Hour
+
+// Range requests for less than this many bytes (or the whole file, if smaller) aren't
+// counted, so players probing a file or fetching its header don't inflate the numbers
+const minDownloadBytes = 1 << 20
+
+// User-Agent fragments of crawlers and scripts that aren't listeners
+var botUserAgents = []string{
+	"bot", "crawler", "spider", "slurp", "facebookexternalhit", "curl", "wget",
+	"python-requests", "python-urllib", "go-http-client", "java/", "headless", "feedfetcher",
+}
+
+// Client apps recognized in User-Agents, checked in order
+var clientApps = []struct{ match, name string }{
+	{"pinepods", "PinePods"},
+	{"spotify", "Spotify"},
+	{"overcast", "Overcast"},
+	{"pocketcasts", "Pocket Casts"},
+	{"pocket casts", "Pocket Casts"},
+	{"castro", "Castro"},
+	{"antennapod", "AntennaPod"},
+	{"podcastaddict", "Podcast Addict"},
+	{"podcast addict", "Podcast Addict"},
+	{"castbox", "Castbox"},
+	{"podverse", "Podverse"},
+	{"podcasts/", "Apple Podcasts"},
+	{"applecoremedia", "Apple Podcasts"},
+	{"itunes", "Apple Podcasts"},
+	{"vlc", "VLC"},
+	{"firefox", "Web browser"},
+	{"chrome", "Web browser"},
+	{"safari", "Web browser"},
+}
+
+var (
+	downloadsMu   sync.Mutex
+	recentClients map[string]time.Time // Last counted download per podcast, file and client
+)
+
+// downloadLogPath returns the path of the download log, next to the config file
+func downloadLogPath() string {
+	return filepath.Join(filepath.Dir(cfgFile), "downloads.log")
+}
+
+// recordDownload counts a request for an episode's audio file, unless it comes from a
+// bot, asks for only a small part of the file, or repeats a recent download
+func recordDownload(r *http.Request, podcastName, file string, size int64) {
+	userAgent := r.UserAgent()
+	if r.Method != http.MethodGet || isBotUserAgent(userAgent) || requestedBytes(r.Header.Get("Range"), size) < min(minDownloadBytes, size) {
+		return
+	}
+
+	sum := sha256.Sum256([]byte(remoteHost(r) + "|" + userAgent))
+	download := Download{
+		Time:    time.Now().UTC(),
+		Podcast: podcastName,
+		File:    file,
+		Client:  hex.EncodeToString(sum[:12]),
+		App:     clientApp(userAgent),
+	}
+
+	downloadsMu.Lock()
+	defer downloadsMu.Unlock()
+
+	if recentClients == nil {
+		loadRecentClients()
+	}
+	key := download.Podcast + "|" + download.File + "|" + download.Client
+	if last, seen := recentClients[key]; seen && download.Time.Sub(last) < downloadWindow {
+		return
+	}
+	recentClients[key] = download.Time
+	if len(recentClients)%1000 == 0 {
+		pruneRecentClients(download.Time)
+	}
+
+	data, err := json.Marshal(download)
+	if err != nil {
+		return
+	}
+	logFile, err := os.OpenFile(downloadLogPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Error("Failed to open download log", "error", err)
+		return
+	}
+	defer logFile.Close()
+	logFile.Write(append(data, '\n'))
+}
+
+// loadRecentClients seeds the de-duplication window from the download log, so restarting
+// the server doesn't count the same listeners again. Callers must hold downloadsMu.
+func loadRecentClients() {
+	recentClients = make(map[string]time.Time)
+	since := time.Now().Add(-downloadWindow)
+	readDownloads(func(download Download) {
+		if download.Time.After(since) {
+			recentClients[download.Podcast+"|"+download.File+"|"+download.Client] = download.Time
+		}
+	})
+}
+
+// pruneRecentClients forgets downloads that have left the window. Callers must hold downloadsMu.
+func pruneRecentClients(now time.Time) {
+	for key, last := range recentClients {
+		if now.Sub(last) >= downloadWindow {
+			delete(recentClients, key)
+		}
+	}
+}
+
+// requestedBytes returns how much of a file a request asks for, given its Range header
+func requestedBytes(rangeHeader string, size int64) int64 {
+	spec, found := strings.CutPrefix(rangeHeader, "bytes=")
+	if !found {
+		return size
+	}
+	spec, _, _ = strings.Cut(spec, ",") // Players only ever ask for one range
+	startText, endText, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return size
+	}
+
+	if startText == "" {
+		suffix, err := strconv.ParseInt(endText, 10, 64)
+		if err != nil {
+			return size
+		}
+		return min(suffix, size)
+	}
+
+	start, err := strconv.ParseInt(startText, 10, 64)
+	if err != nil || start >= size {
+		return 0
+	}
+	end := size - 1
+	if endText != "" {
+		if end, err = strconv.ParseInt(endText, 10, 64); err != nil {
+			return size
+		}
+		end = min(end, size-1)
+	}
+	return max(end-start+1, 0)
+}
+
+// isBotUserAgent reports whether a User-Agent belongs to a crawler or script
+func isBotUserAgent(userAgent string) bool {
+	if userAgent == "" {
+		return true
+	}
+	lower := strings.ToLower(userAgent)
+	for _, bot := range botUserAgents {
+		if strings.Contains(lower, bot) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientApp names the podcast app behind a User-Agent, falling back to its first product token
+func clientApp(userAgent string) string {
+	lower := strings.ToLower(userAgent)
+	for _, app := range clientApps {
+		if strings.Contains(lower, app.match) {
+			return app.name
+		}
+	}
+	product, _, _ := strings.Cut(userAgent, " ")
+	product, _, _ = strings.Cut(product, "/")
+	if product == "" {
+		return "Unknown"
+	}
+	return product
+}
+
+// readDownloads calls fn for every download in the log
+func readDownloads(fn func(Download)) {
+	file, err := os.Open(downloadLogPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Error("Failed to open download log", "error", err)
+		}
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var download Download
+		if err := json.Unmarshal(scanner.Bytes(), &download); err != nil {
+			continue
+		}
+		fn(download)
+	}
+}
+
+// downloadTally is what downloads are counted by in the download totals
+type downloadTally struct {
+	Podcast, Day, File, App string
+}
+
+// Download counts read from the download log so far, so reports only read what was
+// appended since the last one
+var downloadTotals struct {
+	sync.Mutex
+	offset int64 // Bytes of the log counted
+	counts map[downloadTally]int
+}
+
+// countDownloads returns the downloads in the log, counted per podcast, local day, file and app
+func countDownloads() map[downloadTally]int {
+	downloadTotals.Lock()
+	defer downloadTotals.Unlock()
+
+	file, err := os.Open(downloadLogPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Error("Failed to open download log", "error", err)
+		}
+		downloadTotals.offset, downloadTotals.counts = 0, nil
+		return nil
+	}
+	defer file.Close()
+
+	// Start over when the log was replaced or truncated
+	if info, err := file.Stat(); err != nil || info.Size() < downloadTotals.offset || downloadTotals.counts == nil {
+		downloadTotals.offset, downloadTotals.counts = 0, make(map[downloadTally]int)
+	}
+	if _, err := file.Seek(downloadTotals.offset, io.SeekStart); err != nil {
+		slog.Error("Failed to read download log", "error", err)
+		return nil
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			break // A partial last line is counted once it's complete
+		}
+		downloadTotals.offset += int64(len(line))
+
+		var download Download
+		if err := json.Unmarshal(line, &download); err != nil {
+			continue
+		}
+		tally := downloadTally{download.Podcast, download.Time.Local().Format("2006-01-02"), download.File, download.App}
+		downloadTotals.counts[tally]++
+	}
+
+	counts := make(map[downloadTally]int, len(downloadTotals.counts))
+	for tally, count := range downloadTotals.counts {
+		counts[tally] = count
+	}
+	return counts
+}
+
+// downloadReports summarizes downloads since a time (all time when zero) for the given
+// podcasts, in name order
+func downloadReports(podcasts map[string]Podcast, since time.Time) []DownloadReport {
+	var podcastNames []string
+	reports := make(map[string]*DownloadReport)
+	episodes := make(map[string]map[string]int)
+	days := make(map[string]map[string]int)
+	apps := make(map[string]map[string]int)
+	for name := range podcasts {
+		podcastNames = append(podcastNames, name)
+		reports[name] = &DownloadReport{Podcast: name}
+		episodes[name] = make(map[string]int)
+		days[name] = make(map[string]int)
+		apps[name] = make(map[string]int)
+	}
+	sort.Strings(podcastNames)
+
+	sinceDay := ""
+	if !since.IsZero() {
+		sinceDay = since.Local().Format("2006-01-02")
+	}
+	for tally, count := range countDownloads() {
+		report, wanted := reports[tally.Podcast]
+		if !wanted || tally.Day < sinceDay {
+			continue
+		}
+		report.Downloads += count
+		episodes[tally.Podcast][tally.File] += count
+		days[tally.Podcast][tally.Day] += count
+		apps[tally.Podcast][tally.App] += count
+	}
+
+	var result []DownloadReport
+	for _, name := range podcastNames {
+		report := reports[name]
+		podcast := podcasts[name]
+
+		for file, count := range episodes[name] {
+			title := file
+			for _, episode := range podcast.Episodes {
+				if rel, err := filepath.Rel(podcast.AudioDir, episode.FilePath); err == nil && filepath.ToSlash(rel) == file {
+					title = html.UnescapeString(episode.Title)
+				}
+			}
+			report.Episodes = append(report.Episodes, EpisodeCount{Title: title, File: file, Downloads: count})
+		}
+		sort.Slice(report.Episodes, func(i, j int) bool {
+			if report.Episodes[i].Downloads != report.Episodes[j].Downloads {
+				return report.Episodes[i].Downloads > report.Episodes[j].Downloads
+			}
+			return report.Episodes[i].File < report.Episodes[j].File
+		})
+
+		for day, count := range days[name] {
+			report.Days = append(report.Days, DayCount{Day: day, Downloads: count})
+		}
+		sort.Slice(report.Days, func(i, j int) bool { return report.Days[i].Day < report.Days[j].Day })
+
+		for app, count := range apps[name] {
+			report.Apps = append(report.Apps, AppCount{App: app, Downloads: count})
+		}
+		sort.Slice(report.Apps, func(i, j int) bool {
+			if report.Apps[i].Downloads != report.Apps[j].Downloads {
+				return report.Apps[i].Downloads > report.Apps[j].Downloads
+			}
+			return report.Apps[i].App < report.Apps[j].App
+		})
+
+		result = append(result, *report)
+	}
+	return result
+}
+
+// statsSince returns the start of a reporting period of the given number of days, zero for all time
+func statsSince(days int) time.Time {
+	if days <= 0 {
+		return time.Time{}
+	}
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day()-days+1, 0, 0, 0, 0, now.Location())
+}
+
+// serveStatsAPI serves download reports as JSON. Private and access-restricted podcasts
+// are left out.
+func serveStatsAPI(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if value := r.URL.Query().Get("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "days must be a number", http.StatusBadRequest)
+			return
+		}
+		days = parsed
+	}
+	only := r.URL.Query().Get("podcast")
+
+	// Copy the podcasts, so the log is read without holding up config writes
+	podcasts := make(map[string]Podcast)
+	configMu.RLock()
+	for name, podcast := range config.Podcasts {
+		if restrictedPodcast(podcast) || (only != "" && name != only) {
+			continue
+		}
+		podcasts[name] = podcast
+	}
+	configMu.RUnlock()
+	reports := downloadReports(podcasts, statsSince(days))
+
+	if only != "" && len(reports) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// stats prints download counts per episode, per day and per client app
+func stats(cmd *cobra.Command, args []string) {
+	name, _ := cmd.Flags().GetString("name")
+	days, _ := cmd.Flags().GetInt("days")
+
+	podcasts := config.Podcasts
+	if name != "" {
+		podcast, exists := config.Podcasts[name]
+		if !exists {
+			fmt.Printf("Podcast '%s' does not exist\n", name)
+			return
+		}
+		podcasts = map[string]Podcast{name: podcast}
+	}
+
+	if len(podcasts) == 0 {
+		fmt.Println("No podcasts found")
+		return
+	}
+
+	period := "all time"
+	if days > 0 {
+		period = fmt.Sprintf("last %d days", days)
+	}
+
+	for i, report := range downloadReports(podcasts, statsSince(days)) {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s: %d downloads (%s)\n", report.Podcast, report.Downloads, period)
+		if report.Downloads == 0 {
+			continue
+		}
+
+		fmt.Println("Episodes:")
+		for _, episode := range report.Episodes {
+			fmt.Printf("  %6d  %s\n", episode.Downloads, episode.Title)
+		}
+		fmt.Println("Days:")
+		for _, day := range report.Days {
+			fmt.Printf("  %6d  %s\n", day.Downloads, day.Day)
+		}
+		fmt.Println("Apps:")
+		for _, app := range report.Apps {
+			fmt.Printf("  %6d  %s\n", app.Downloads, app.App)
+		}
+	}
+}
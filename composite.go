@@ -0,0 +1,206 @@
+// composite.go
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Composite describes a feed whose items are merged from other feeds at render time
+type Composite struct {
+	Members []CompositeMember `json:"members"`
+	Limit   int               `json:"limit,omitempty"` // Maximum number of items, 0 for no limit
+}
+
+// CompositeMember is one feed included in a composite feed
+type CompositeMember struct {
+	Feed        string `json:"feed"`
+	TitlePrefix string `json:"titlePrefix,omitempty"`
+}
+
+// createCompositeFeed creates a feed that merges several existing feeds
+func createCompositeFeed(cmd *cobra.Command, args []string) {
+	name, _ := cmd.Flags().GetString("name")
+	title, _ := cmd.Flags().GetString("title")
+	description, _ := cmd.Flags().GetString("description")
+	link, _ := cmd.Flags().GetString("link")
+	memberSpecs, _ := cmd.Flags().GetStringArray("member")
+	limit, _ := cmd.Flags().GetInt("limit")
+
+	if err := validFeedName(name); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if _, exists := config.Feeds[name]; exists {
+		fmt.Printf("Feed '%s' already exists\n", name)
+		return
+	}
+
+	if limit < 0 {
+		fmt.Println("Limit must not be negative")
+		return
+	}
+
+	var members []CompositeMember
+	for _, spec := range memberSpecs {
+		member := CompositeMember{Feed: spec}
+		if i := strings.Index(spec, "="); i != -1 {
+			member = CompositeMember{Feed: spec[:i], TitlePrefix: spec[i+1:]}
+		}
+
+		memberFeed, exists := config.Feeds[member.Feed]
+		if !exists {
+			fmt.Printf("Feed '%s' does not exist\n", member.Feed)
+			return
+		}
+		if memberFeed.Composite != nil {
+			fmt.Printf("Feed '%s' is a composite feed and can't be a member of another composite feed\n", member.Feed)
+			return
+		}
+		members = append(members, member)
+	}
+
+	if len(members) == 0 {
+		fmt.Println("A composite feed needs at least one --member")
+		return
+	}
+
+	now := time.Now()
+	config.Feeds[name] = Feed{
+		Title:       title,
+		Description: description,
+		Link:        link,
+		Created:     now,
+		Updated:     now,
+		Items:       []Item{},
+		Composite:   &Composite{Members: members, Limit: limit},
+	}
+
+	saveConfig()
+	emitFeedEvent(eventFeedCreated, name, "feed")
+	fmt.Printf("Composite feed '%s' created with %d members\n", name, len(members))
+}
+
+// feedItems returns the stored items of a feed, or the merged items of a composite
+// feed. Callers running inside the server must hold configMu.
+func feedItems(feed Feed) []Item {
+	if feed.Composite == nil {
+		return feed.Items
+	}
+	return compositeItems(feed)
+}
+
+// renderedItems returns the items of a feed as they are served, with its rules applied.
+// Callers running inside the server must hold configMu.
+func renderedItems(feed Feed) []Item {
+	if feed.Composite == nil {
+		return applyRules(feed.Rules, feed.Items, nil)
+	}
+	return compositeItems(feed)
+}
+
+// compositeItems merges the member feeds of a composite feed, applies its rules and
+// keeps the newest items up to the limit, presented oldest first like regular feeds
+func compositeItems(feed Feed) []Item {
+	items := applyRules(feed.Rules, mergedCompositeItems(feed), nil)
+
+	if limit := feed.Composite.Limit; limit > 0 && len(items) > limit {
+		items = items[len(items)-limit:]
+	}
+	return items
+}
+
+// mergedCompositeItems collects the rendered items of every member feed, oldest first,
+// keeping only the newest copy of items that share a GUID or link. Private or
+// access-restricted members are only included in composite feeds readable by exactly the
+// same subscribers, users and networks.
+func mergedCompositeItems(feed Feed) []Item {
+	var merged []Item
+	for _, member := range feed.Composite.Members {
+		memberFeed, exists := config.Feeds[member.Feed]
+		if !exists || memberFeed.Composite != nil {
+			slog.Warn("Skipping composite member that is not a regular feed", "composite", feed.Title, "member", member.Feed)
+			continue
+		}
+		if restrictedFeed(memberFeed) && feedAccessKey(memberFeed) != feedAccessKey(feed) {
+			slog.Warn("Skipping restricted composite member whose access differs from the composite", "composite", feed.Title, "member", member.Feed)
+			continue
+		}
+
+		// Items name the member feed as their source: its URL on this server when the public
+		// URL is known, or else the site it links to
+		source := memberFeed.Link
+		if publicURL := serverPublicURL(); publicURL != "" {
+			source = publicURL + "/" + member.Feed
+		}
+
+		for _, item := range renderedItems(memberFeed) {
+			item.Title = member.TitlePrefix + item.Title
+			if item.Source == "" && item.SourceTitle == "" {
+				item.Source, item.SourceTitle = source, memberFeed.Title
+			}
+			merged = append(merged, item)
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Created.After(merged[j].Created)
+	})
+
+	seen := make(map[string]bool)
+	items := make([]Item, 0, len(merged))
+	for _, item := range merged {
+		if key := itemKey(item); key != "" {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		items = append(items, item)
+	}
+
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+
+	return items
+}
+
+// feedAccessKey describes who may read a feed: its private flag, subscriber tokens, users
+// and allowed networks, in a form that is equal for feeds with the same readers
+func feedAccessKey(feed Feed) string {
+	var readers []string
+	if feed.Private {
+		for _, subscriber := range feed.Subscribers {
+			readers = append(readers, "token:"+subscriber.Token)
+		}
+	}
+	if feed.Access != nil {
+		for _, user := range feed.Access.Users {
+			readers = append(readers, "user:"+user.Username+":"+user.PasswordHash)
+		}
+		for _, network := range feed.Access.AllowedNetworks {
+			readers = append(readers, "network:"+network)
+		}
+	}
+	sort.Strings(readers)
+	return fmt.Sprintf("private:%t %s", feed.Private, strings.Join(readers, " "))
+}
+
+// latestItemTime returns the newest of updated and the creation and update times of items
+func latestItemTime(updated time.Time, items []Item) time.Time {
+	for _, item := range items {
+		if item.Updated.After(updated) {
+			updated = item.Updated
+		}
+		if item.Created.After(updated) {
+			updated = item.Created
+		}
+	}
+	return updated
+}
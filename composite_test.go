@@ -0,0 +1,109 @@
+// composite_test.go
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// compositeOf returns a composite feed of the given members with the access of restricted
+func compositeOf(restricted Feed, members ...string) Feed {
+	feed := restricted
+	feed.Title = "Composite"
+	feed.Composite = &Composite{}
+	for _, member := range members {
+		feed.Composite.Members = append(feed.Composite.Members, CompositeMember{Feed: member})
+	}
+	return feed
+}
+
+func TestCompositeSkipsMembersWithDifferentAccess(t *testing.T) {
+	saved := config
+	t.Cleanup(func() { config = saved })
+
+	alice := []Subscriber{{ID: "a", Name: "alice", Token: "alice-token"}}
+	bob := []Subscriber{{ID: "b", Name: "bob", Token: "bob-token"}}
+	users := &AccessPolicy{Users: []BasicUser{{Username: "carol", PasswordHash: "hash"}}}
+	office := &AccessPolicy{AllowedNetworks: []string{"10.20.0.0/16"}}
+
+	member := func(title string, feed Feed) Feed {
+		feed.Title = title
+		feed.Items = []Item{{Title: title, GUID: title, Created: time.Now()}}
+		return feed
+	}
+	config = Config{Feeds: map[string]Feed{
+		"public":      member("public", Feed{}),
+		"alice":       member("alice", Feed{Private: true, Subscribers: alice}),
+		"bob":         member("bob", Feed{Private: true, Subscribers: bob}),
+		"carol":       member("carol", Feed{Access: users}),
+		"office":      member("office", Feed{Access: office}),
+		"alice-carol": member("alice-carol", Feed{Private: true, Subscribers: alice, Access: users}),
+	}}
+	all := []string{"public", "alice", "bob", "carol", "office", "alice-carol"}
+
+	tests := []struct {
+		name   string
+		access Feed
+		want   []string
+	}{
+		{"public composite", Feed{}, []string{"public"}},
+		{"private to alice", Feed{Private: true, Subscribers: alice}, []string{"public", "alice"}},
+		{"private to bob", Feed{Private: true, Subscribers: bob}, []string{"public", "bob"}},
+		{"private to alice and bob", Feed{Private: true, Subscribers: append(append([]Subscriber{}, alice...), bob...)}, []string{"public"}},
+		{"password for carol", Feed{Access: users}, []string{"public", "carol"}},
+		{"office network", Feed{Access: office}, []string{"public", "office"}},
+		{"alice with carol's password", Feed{Private: true, Subscribers: alice, Access: users}, []string{"public", "alice-carol"}},
+		{"public with leftover subscribers", Feed{Subscribers: bob}, []string{"public"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := map[string]bool{}
+			for _, item := range mergedCompositeItems(compositeOf(test.access, all...)) {
+				got[item.Title] = true
+			}
+			if len(got) != len(test.want) {
+				t.Errorf("composite has items of %v, want %v", got, test.want)
+			}
+			for _, title := range test.want {
+				if !got[title] {
+					t.Errorf("composite has items of %v, want %v", got, test.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestCompositeItemSources(t *testing.T) {
+	saved := config
+	t.Cleanup(func() { config = saved })
+
+	config = Config{Feeds: map[string]Feed{
+		"blog": {Title: "Blog", Link: "https://blog.example.com/", Items: []Item{
+			{Title: "Own", GUID: "own", Created: time.Now()},
+			{Title: "Mirrored", GUID: "mirrored", Created: time.Now(), Source: "https://upstream.example.com/feed", SourceTitle: "Upstream"},
+		}},
+	}}
+	composite := compositeOf(Feed{}, "blog")
+
+	sources := func() map[string]Item {
+		items := map[string]Item{}
+		for _, item := range mergedCompositeItems(composite) {
+			items[item.Title] = item
+		}
+		return items
+	}
+
+	items := sources()
+	if own := items["Own"]; own.Source != "https://blog.example.com/" || own.SourceTitle != "Blog" {
+		t.Errorf("without a public URL, source is %q %q, want the member's link and title", own.Source, own.SourceTitle)
+	}
+	if mirrored := items["Mirrored"]; mirrored.Source != "https://upstream.example.com/feed" || mirrored.SourceTitle != "Upstream" {
+		t.Errorf("mirrored item source is %q %q, want the original source kept", mirrored.Source, mirrored.SourceTitle)
+	}
+
+	config.PublicURL = "https://feeds.example.com/"
+	if own := sources()["Own"]; own.Source != "https://feeds.example.com/blog" || own.SourceTitle != "Blog" {
+		t.Errorf("with a public URL, source is %q %q, want the member's URL on this server", own.Source, own.SourceTitle)
+	}
+}
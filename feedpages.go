@@ -0,0 +1,230 @@
+// feedpages.go
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FeedPage is what the HTML page of a feed or podcast shows
+type FeedPage struct {
+	Name          string
+	Title         string
+	Description   string
+	Link          string // Website of the feed or podcast
+	Author        string
+	ImageURL      string
+	FeedURL       string // URL of the RSS document, with the subscriber's token for private feeds
+	Podcast       bool
+	Subscribe     []SubscribeLink
+	StylesheetURL string
+	Items         []PageItem
+}
+
+// PageItem is an item or episode on a feed page
+type PageItem struct {
+	Title      string
+	Link       string
+	Published  time.Time
+	ImageURL   string
+	Content    template.HTML // Item content or show notes, sanitized
+	Categories []string
+	AudioURL   string
+	MimeType   string
+	Duration   string
+	Season     int
+	Episode    int
+}
+
+// SubscribeLink opens a feed in a reader or podcast app
+type SubscribeLink struct {
+	Name string
+	URL  template.URL
+}
+
+// serveFeedPage serves the HTML page of a feed at /<name>/
+func (t *siteTheme) serveFeedPage(w http.ResponseWriter, r *http.Request, feedName string) {
+	subscriber, ok := authorizeSubscriber(w, r, feedName)
+	if !ok {
+		return
+	}
+
+	configMu.RLock()
+	feed, exists := config.Feeds[feedName]
+	items := renderedItems(feed)
+	feedURL := publicBaseURL(r) + "/" + feedName
+	configMu.RUnlock()
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+	if subscriber != nil {
+		feedURL += "?token=" + url.QueryEscape(subscriber.Token)
+	}
+
+	page := FeedPage{
+		Name:        feedName,
+		Title:       feed.Title,
+		Description: feed.Description,
+		Link:        feed.Link,
+		Author:      feed.Author,
+		FeedURL:     feedURL,
+		Subscribe:   feedSubscribeLinks(feedURL),
+	}
+	for _, item := range items {
+		content := item.Content
+		if content == "" {
+			content = item.Description
+		}
+		// Imported titles and plain-text descriptions often carry entities like &amp;,
+		// which the template would escape a second time
+		if !looksLikeHTML(content) {
+			content = html.UnescapeString(content)
+		}
+		page.Items = append(page.Items, PageItem{
+			Title:      html.UnescapeString(item.Title),
+			Link:       item.Link,
+			Published:  item.Created,
+			ImageURL:   item.ImageURL,
+			Content:    renderContent(content),
+			Categories: item.Categories,
+		})
+	}
+
+	t.writeFeedPage(w, page)
+}
+
+// servePodcastPage serves the HTML page of a podcast, with a player for each episode
+func (t *siteTheme) servePodcastPage(w http.ResponseWriter, r *http.Request, podcastName string) {
+	subscriber, ok := authorizeSubscriber(w, r, podcastName)
+	if !ok {
+		return
+	}
+
+	configMu.RLock()
+	podcast, exists := config.Podcasts[podcastName]
+	signURL := podcastMediaSigner(podcast, subscriber)
+	feedURL := podcast.BaseURL
+	if subscriber != nil {
+		if privateURL, err := privateFeedURL(podcastName, *subscriber); err == nil {
+			feedURL = privateURL
+		}
+	}
+	configMu.RUnlock()
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	// The player fetches audio like a podcast app would, so it needs signed URLs too
+	if signURL != nil {
+		podcast = signPodcastURLs(podcast, signURL)
+	}
+
+	page := FeedPage{
+		Name:        podcastName,
+		Title:       podcast.Title,
+		Description: podcast.Description,
+		Link:        podcast.Link,
+		Author:      podcast.Author,
+		ImageURL:    podcast.ImageURL,
+		FeedURL:     feedURL,
+		Podcast:     true,
+		Subscribe:   podcastSubscribeLinks(feedURL),
+	}
+	// Episode titles and descriptions are stored HTML-escaped, like in the feed
+	for _, episode := range podcast.Episodes {
+		if episode.AudioURL == "" {
+			continue
+		}
+		page.Items = append(page.Items, PageItem{
+			Title:     html.UnescapeString(episode.Title),
+			Published: episode.Published,
+			ImageURL:  episode.ImageURL,
+			Content:   renderContent(html.UnescapeString(episode.Description)),
+			AudioURL:  episode.AudioURL,
+			MimeType:  episode.MimeType,
+			Duration:  formatEpisodeDuration(episode.Duration),
+			Season:    episode.Season,
+			Episode:   episode.Episode,
+		})
+	}
+
+	t.writeFeedPage(w, page)
+}
+
+// writeFeedPage renders a feed page, newest items first
+func (t *siteTheme) writeFeedPage(w http.ResponseWriter, page FeedPage) {
+	sort.SliceStable(page.Items, func(i, j int) bool {
+		return page.Items[i].Published.After(page.Items[j].Published)
+	})
+
+	page.StylesheetURL = t.assetURL(themeFeedStylesheet)
+	var buf bytes.Buffer
+	if err := t.feed.Execute(&buf, page); err != nil {
+		slog.Error("Failed to render feed page", "feed", page.Name, "error", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// publicBaseURL returns the URL the server is reached at: the configured public URL, or
+// else the scheme and host of the request. X-Forwarded-Proto is only believed from a
+// trusted proxy. Callers running inside the server must hold configMu.
+func publicBaseURL(r *http.Request) string {
+	if publicURL := serverPublicURL(); publicURL != "" {
+		return publicURL
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	scheme := "http"
+	if r.TLS != nil || (fromTrustedProxy(r, host) && r.Header.Get("X-Forwarded-Proto") == "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// feedSubscribeLinks returns links that hand a feed to the visitor's feed reader
+func feedSubscribeLinks(feedURL string) []SubscribeLink {
+	return []SubscribeLink{
+		{"Feed reader", template.URL("feed:" + feedURL)},
+		{"RSS", template.URL(feedURL)},
+	}
+}
+
+// podcastSubscribeLinks returns links that subscribe to a podcast in common podcast apps
+func podcastSubscribeLinks(feedURL string) []SubscribeLink {
+	bare := strings.TrimPrefix(strings.TrimPrefix(feedURL, "https://"), "http://")
+	return []SubscribeLink{
+		{"Apple Podcasts", template.URL("podcast://" + bare)},
+		{"Overcast", template.URL("overcast://x-callback-url/add?url=" + url.QueryEscape(feedURL))},
+		{"Pocket Casts", template.URL("pktc://subscribe/" + bare)},
+		{"AntennaPod", template.URL("antennapod-subscribe://" + bare)},
+		{"RSS", template.URL(feedURL)},
+	}
+}
+
+// formatEpisodeDuration formats a duration as h:mm:ss or m:ss, "" when unknown
+func formatEpisodeDuration(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	s := int(d.Round(time.Second).Seconds())
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
@@ -0,0 +1,93 @@
+// feedroutes.go
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+)
+
+// feedRoutes serves the feeds, podcasts, pages and media of the config. The routes are
+// rebuilt when feeds are added or removed while the server runs, e.g. from the admin UI.
+type feedRoutes struct {
+	limits *abuseLimits
+	theme  *siteTheme
+	router atomic.Pointer[mux.Router]
+}
+
+// newFeedRoutes builds the routes of the feeds and podcasts in the config
+func newFeedRoutes(limits *abuseLimits, theme *siteTheme) *feedRoutes {
+	routes := &feedRoutes{limits: limits, theme: theme}
+	routes.rebuild()
+	return routes
+}
+
+func (f *feedRoutes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.router.Load().ServeHTTP(w, r)
+}
+
+// rebuild replaces the routes with ones for the feeds and podcasts in the config now.
+// It takes configMu, so callers must not hold it.
+func (f *feedRoutes) rebuild() {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
+	limits, theme := f.limits, f.theme
+	r := mux.NewRouter()
+	r.Use(metricsMiddleware)
+	r.NotFoundHandler = metricsMiddleware(http.NotFoundHandler())
+
+	// Handle regular RSS feeds
+	for name := range config.Feeds {
+		feedName := name // Capture for closure
+		r.Handle("/"+feedName, logFeedName(feedName, limits.limitRequests(requireAccessPolicy(feedName, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serveRSSFeed(w, r, feedName)
+		})))))
+	}
+
+	// Handle podcast feeds
+	for name, podcast := range config.Podcasts {
+		podcastName := name // Capture for closure
+		r.Handle(podcastURLPath(podcastName, podcast), logFeedName(podcastName, limits.limitRequests(requireAccessPolicy(podcastName, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			servePodcastFeed(w, r, podcastName)
+		})))))
+	}
+
+	// Handle the HTML pages of feeds and podcasts
+	for name := range config.Feeds {
+		feedName := name // Capture for closure
+		r.Handle("/"+feedName+"/", logFeedName(feedName, limits.limitRequests(requireAccessPolicy(feedName, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			theme.serveFeedPage(w, r, feedName)
+		})))))
+	}
+	for name, podcast := range config.Podcasts {
+		podcastName := name // Capture for closure
+		r.Handle(podcastURLPath(podcastName, podcast)+"/", logFeedName(podcastName, limits.limitRequests(requireAccessPolicy(podcastName, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			theme.servePodcastPage(w, r, podcastName)
+		})))))
+	}
+
+	// Serve audio files
+	for name, podcast := range config.Podcasts {
+		podcastName := name // Capture for closure
+		if podcast.AudioDir == "" {
+			continue // Imported podcasts may link to externally hosted audio
+		}
+		urlPath := podcastURLPath(podcastName, podcast)
+		audioPath := urlPath + "/audio/"
+		r.PathPrefix(audioPath).Handler(logFeedName(podcastName, limits.limitRequests(limits.limitDownloads(
+			requireAccessPolicy(podcastName, requireMediaSignature(podcastName, urlPath, true,
+				countPodcastBytes(podcastName, audioHandler(podcastName, audioPath)),
+			)),
+		))))
+
+		// Serve artwork files
+		artworkPath := urlPath + "/artwork/"
+		r.PathPrefix(artworkPath).Handler(logFeedName(podcastName, limits.limitRequests(requireAccessPolicy(podcastName, requireMediaSignature(podcastName, urlPath, false,
+			countPodcastBytes(podcastName, artworkHandler(podcastName, artworkPath)),
+		)))))
+	}
+
+	f.router.Store(r)
+}
@@ -0,0 +1,192 @@
+// health.go
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Default time the healthcheck command waits for the server
+const defaultHealthcheckTimeout = 5 * time.Second
+
+// HealthReport is the JSON body of /healthz and /readyz
+type HealthReport struct {
+	Status string        `json:"status"`
+	Checks []HealthCheck `json:"checks,omitempty"`
+}
+
+// HealthCheck is the result of one readiness check
+type HealthCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// recordScanResult stores whether the last scan of a podcast succeeded in the config, so
+// /readyz sees refreshes run from the CLI too. Callers running inside the server must hold
+// configMu.
+func recordScanResult(name string, err error) {
+	podcast, exists := config.Podcasts[name]
+	if !exists {
+		return
+	}
+	podcast.LastScan, podcast.ScanError = time.Now(), ""
+	if err != nil {
+		podcast.ScanError = err.Error()
+	}
+	config.Podcasts[name] = podcast
+}
+
+// serveHealthz reports that the process is up
+func serveHealthz(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(w, http.StatusOK, HealthReport{Status: "ok"})
+}
+
+// serveReadyz reports whether the server can serve its feeds: the config file loads,
+// every podcast audio directory is readable, and the last scan of each podcast and the
+// last fetch of each mirrored feed succeeded
+func serveReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := readinessChecks()
+
+	report := HealthReport{Status: "ready", Checks: checks}
+	status := http.StatusOK
+	for _, check := range checks {
+		if !check.OK {
+			report.Status = "not ready"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeHealthReport(w, status, report)
+}
+
+// readinessChecks runs the checks behind /readyz. Refresh results come from the config
+// file, where CLI commands and the server both record them.
+func readinessChecks() []HealthCheck {
+	checks := []HealthCheck{{Name: "config", OK: true}}
+	current, err := readConfig()
+	if err != nil {
+		checks[0] = HealthCheck{Name: "config", Error: err.Error()}
+		configMu.RLock()
+		current = config
+		configMu.RUnlock()
+	}
+
+	var podcastNames, feedNames []string
+	for name := range current.Podcasts {
+		podcastNames = append(podcastNames, name)
+	}
+	for name, feed := range current.Feeds {
+		if feed.Remote != nil {
+			feedNames = append(feedNames, name)
+		}
+	}
+	sort.Strings(podcastNames)
+	sort.Strings(feedNames)
+
+	for _, name := range podcastNames {
+		podcast := current.Podcasts[name]
+		if podcast.AudioDir == "" {
+			continue
+		}
+		check := HealthCheck{Name: "audio:" + name, OK: true}
+		if err := checkReadableDir(podcast.AudioDir); err != nil {
+			check = HealthCheck{Name: check.Name, Error: err.Error()}
+		}
+		checks = append(checks, check)
+	}
+
+	for _, name := range podcastNames {
+		if podcast := current.Podcasts[name]; !podcast.LastScan.IsZero() {
+			checks = append(checks, HealthCheck{Name: "refresh:" + name, OK: podcast.ScanError == "", Error: podcast.ScanError})
+		}
+	}
+	for _, name := range feedNames {
+		if remote := current.Feeds[name].Remote; !remote.LastFetched.IsZero() {
+			checks = append(checks, HealthCheck{Name: "remote:" + name, OK: remote.LastError == "", Error: remote.LastError})
+		}
+	}
+
+	return checks
+}
+
+// checkReadableDir verifies that a directory exists and can be listed
+func checkReadableDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Readdirnames(1); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// writeHealthReport writes a health report as JSON
+func writeHealthReport(w http.ResponseWriter, status int, report HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// healthcheck probes a running server's readiness endpoint and exits non-zero when it
+// isn't ready, for use as a Docker HEALTHCHECK
+func healthcheck(cmd *cobra.Command, args []string) {
+	port, _ := cmd.Flags().GetString("port")
+	target, _ := cmd.Flags().GetString("url")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	insecure, _ := cmd.Flags().GetBool("insecure")
+	socket, _ := cmd.Flags().GetString("socket")
+
+	transport := &http.Transport{}
+	if insecure {
+		// The certificate is issued for the public domain, not the address we probe
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	if socket != "" {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		}
+		if target == "" {
+			target = "http://localhost/readyz"
+		}
+	}
+	if target == "" {
+		target = "http://127.0.0.1:" + port + "/readyz"
+	}
+
+	client := &http.Client{Timeout: timeout, Transport: transport}
+	resp, err := client.Get(target)
+	if err != nil {
+		fmt.Printf("Health check failed: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	var report HealthReport
+	json.NewDecoder(resp.Body).Decode(&report)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("Health check failed: %s\n", resp.Status)
+		for _, check := range report.Checks {
+			if !check.OK {
+				fmt.Printf("- %s: %s\n", check.Name, check.Error)
+			}
+		}
+		os.Exit(1)
+	}
+
+	fmt.Printf("Healthy (%s)\n", report.Status)
+}
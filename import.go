@@ -0,0 +1,322 @@
+// import.go
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// importRow represents a single entry read from an import file
+type importRow struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Content     string `json:"content"`
+	Link        string `json:"link"`
+	ImageURL    string `json:"imageUrl"`
+	GUID        string `json:"guid"`
+	Created     string `json:"created"`
+	Updated     string `json:"updated"`
+
+	line int   // Line number in the import file, for error reporting
+	err  error // Set when the line itself could not be parsed
+}
+
+// importRowError describes why a row of an import file was rejected
+type importRowError struct {
+	Line int
+	Err  error
+}
+
+// Date layouts accepted for entry timestamps, tried in order
+var entryTimeLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC822Z,
+	time.RFC822,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// parseEntryTime parses a timestamp in any of the supported layouts
+func parseEntryTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range entryTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", value)
+}
+
+// itemKey returns the identity used to de-duplicate items: the GUID if set, otherwise the link
+func itemKey(item Item) string {
+	if item.GUID != "" {
+		return "guid:" + item.GUID
+	}
+	if item.Link != "" {
+		return "link:" + item.Link
+	}
+	return ""
+}
+
+// importEntries bulk imports entries into a feed, validating every row before saving
+func importEntries(cmd *cobra.Command, args []string) {
+	feedName, _ := cmd.Flags().GetString("feed")
+	filePath, _ := cmd.Flags().GetString("file")
+	format, _ := cmd.Flags().GetString("format")
+
+	feed, exists := config.Feeds[feedName]
+	if !exists {
+		fmt.Printf("Feed '%s' does not exist\n", feedName)
+		return
+	}
+	if feed.Composite != nil {
+		fmt.Printf("Feed '%s' is a composite feed, import entries into its member feeds instead\n", feedName)
+		return
+	}
+
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(filePath)) {
+		case ".csv":
+			format = "csv"
+		case ".jsonl", ".ndjson", ".json":
+			format = "jsonl"
+		default:
+			fmt.Printf("Cannot detect format of '%s', use --format jsonl|csv\n", filePath)
+			return
+		}
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		fmt.Printf("Failed to open import file: %v\n", err)
+		return
+	}
+	defer file.Close()
+
+	var rows []importRow
+	switch format {
+	case "jsonl":
+		rows, err = readJSONLRows(file)
+	case "csv":
+		rows, err = readCSVRows(file)
+	default:
+		fmt.Printf("Unsupported format '%s', use jsonl or csv\n", format)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Failed to read import file: %v\n", err)
+		return
+	}
+
+	// Validate every row before touching the feed
+	var rowErrors []importRowError
+	items := make([]Item, len(rows))
+	for i, row := range rows {
+		if row.err != nil {
+			rowErrors = append(rowErrors, importRowError{Line: row.line, Err: row.err})
+			continue
+		}
+		item, err := rowToItem(row)
+		if err != nil {
+			rowErrors = append(rowErrors, importRowError{Line: row.line, Err: err})
+			continue
+		}
+		items[i] = item
+	}
+
+	if len(rowErrors) > 0 {
+		fmt.Printf("Import aborted, %d of %d rows are invalid:\n", len(rowErrors), len(rows))
+		for _, rowErr := range rowErrors {
+			fmt.Printf("  line %d: %v\n", rowErr.Line, rowErr.Err)
+		}
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, item := range feed.Items {
+		if key := itemKey(item); key != "" {
+			seen[key] = true
+		}
+	}
+
+	var imported []Item
+	skipped := 0
+	for i, item := range items {
+		key := itemKey(item)
+		if key != "" && seen[key] {
+			fmt.Printf("  line %d: skipped duplicate '%s'\n", rows[i].line, item.Title)
+			skipped++
+			continue
+		}
+		if key != "" {
+			seen[key] = true
+		}
+		imported = append(imported, item)
+	}
+
+	if len(imported) == 0 {
+		fmt.Printf("No new entries to import into feed '%s' (%d duplicates skipped)\n", feedName, skipped)
+		return
+	}
+
+	// Append imported entries oldest first. Existing entries keep their place, since
+	// delete-entry and update-entry address them by index.
+	sort.SliceStable(imported, func(i, j int) bool {
+		return imported[i].Created.Before(imported[j].Created)
+	})
+	feed.Items = append(feed.Items, imported...)
+	feed.Updated = time.Now()
+	config.Feeds[feedName] = feed
+
+	saveConfig()
+	emitItemEvents(feedName, imported, nil)
+	fmt.Printf("Imported %d entries into feed '%s' (%d duplicates skipped)\n", len(imported), feedName, skipped)
+}
+
+// rowToItem validates an import row and converts it to a feed item
+func rowToItem(row importRow) (Item, error) {
+	if strings.TrimSpace(row.Title) == "" {
+		return Item{}, fmt.Errorf("missing title")
+	}
+	if row.Content == "" && row.Description == "" {
+		return Item{}, fmt.Errorf("missing content")
+	}
+
+	now := time.Now()
+	item := Item{
+		Title:       row.Title,
+		Description: row.Description,
+		Content:     row.Content,
+		Link:        row.Link,
+		ImageURL:    row.ImageURL,
+		GUID:        row.GUID,
+		Created:     now,
+	}
+	if item.Description == "" {
+		item.Description = item.Content
+	}
+	if item.Content == "" {
+		item.Content = item.Description
+	}
+
+	if row.Created != "" {
+		created, err := parseEntryTime(row.Created)
+		if err != nil {
+			return Item{}, fmt.Errorf("invalid created date: %v", err)
+		}
+		item.Created = created
+	}
+	item.Updated = item.Created
+	if row.Updated != "" {
+		updated, err := parseEntryTime(row.Updated)
+		if err != nil {
+			return Item{}, fmt.Errorf("invalid updated date: %v", err)
+		}
+		item.Updated = updated
+	}
+
+	return item, nil
+}
+
+// readJSONLRows reads one JSON object per line. Malformed lines are returned as rows with
+// their parse error, so every bad line is reported at once.
+func readJSONLRows(r io.Reader) ([]importRow, error) {
+	var rows []importRow
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var row importRow
+		if err := json.Unmarshal([]byte(text), &row); err != nil {
+			row = importRow{err: fmt.Errorf("invalid JSON: %v", err)}
+		}
+		row.line = line
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// readCSVRows reads a CSV file with a header row
+func readCSVRows(r io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %v", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, fmt.Errorf("CSV header must include a 'title' column")
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, importRow{line: parseErr.StartLine, err: parseErr.Err})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		field := func(names ...string) string {
+			for _, name := range names {
+				if i, ok := columns[name]; ok && i < len(record) {
+					return record[i]
+				}
+			}
+			return ""
+		}
+
+		rows = append(rows, importRow{
+			Title:       field("title"),
+			Description: field("description"),
+			Content:     field("content"),
+			Link:        field("link"),
+			ImageURL:    field("imageurl", "image"),
+			GUID:        field("guid", "id"),
+			Created:     field("created", "date"),
+			Updated:     field("updated"),
+			line:        line,
+		})
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,630 @@
+// importfeed.go
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// XML namespaces recognized when importing feeds
+const (
+	atomNamespace   = "http://www.w3.org/2005/Atom"
+	itunesNamespace = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+)
+
+// rssDocument is the subset of an RSS 2.0 document that can be imported
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// rssChannel fields without a namespace also match namespaced elements such as
+// atom:link or itunes:title, so those are collected as rssText and filtered
+type rssChannel struct {
+	Title            []rssText        `xml:"title"`
+	Link             []rssText        `xml:"link"`
+	Description      []rssText        `xml:"description"`
+	Language         string           `xml:"language"`
+	Copyright        string           `xml:"copyright"`
+	ManagingEditor   string           `xml:"managingEditor"`
+	PubDate          string           `xml:"pubDate"`
+	LastBuildDate    string           `xml:"lastBuildDate"`
+	Image            []rssImage       `xml:"image"` // Also collects itunes:image
+	ItunesAuthor     string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author"`
+	ItunesOwner      itunesOwner      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd owner"`
+	ItunesCategories []itunesCategory `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category"`
+	ItunesExplicit   string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
+	Items            []rssItem        `xml:"item"`
+}
+
+type rssText struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+type rssImage struct {
+	XMLName xml.Name
+	URL     string `xml:"url"`
+	Href    string `xml:"href,attr"`
+}
+
+// channelImage returns the channel artwork, preferring itunes:image over the RSS image
+func channelImage(channel rssChannel) string {
+	var rssURL string
+	for _, image := range channel.Image {
+		switch image.XMLName.Space {
+		case itunesNamespace:
+			if image.Href != "" {
+				return image.Href
+			}
+		case "":
+			if rssURL == "" {
+				rssURL = strings.TrimSpace(image.URL)
+			}
+		}
+	}
+	return rssURL
+}
+
+// rssValue returns the first value that belongs to the RSS (empty) namespace
+func rssValue(values []rssText) string {
+	for _, value := range values {
+		if value.XMLName.Space == "" {
+			return strings.TrimSpace(value.Value)
+		}
+	}
+	return ""
+}
+
+type itunesOwner struct {
+	Name  string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd name"`
+	Email string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd email"`
+}
+
+type itunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type itunesCategory struct {
+	Text          string           `xml:"text,attr"`
+	Subcategories []itunesCategory `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category"`
+}
+
+type rssItem struct {
+	Title          []rssText    `xml:"title"`
+	Link           []rssText    `xml:"link"`
+	Description    []rssText    `xml:"description"`
+	Content        string       `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	GUID           string       `xml:"guid"`
+	Categories     []string     `xml:"category"`
+	PubDate        string       `xml:"pubDate"`
+	Enclosure      rssEnclosure `xml:"enclosure"`
+	ItunesDuration string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	ItunesEpisode  string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode"`
+	ItunesSeason   string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd season"`
+	ItunesImage    itunesImage  `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// atomDocument is the subset of an Atom document that can be imported
+type atomDocument struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    atomText    `xml:"title"`
+	Subtitle atomText    `xml:"subtitle"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Rights   string      `xml:"rights"`
+	Logo     string      `xml:"logo"`
+	Links    []atomLink  `xml:"link"`
+	Author   atomPerson  `xml:"author"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+type atomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email"`
+}
+
+type atomEntry struct {
+	Title      atomText       `xml:"title"`
+	ID         string         `xml:"id"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Summary    atomText       `xml:"summary"`
+	Content    atomText       `xml:"content"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// atomText is an Atom text construct, which may carry inline XHTML
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+// String returns the text content, keeping the markup of XHTML constructs
+func (t atomText) String() string {
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(t.Inner)
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+// importFeed imports an RSS 2.0 or Atom document as a feed or podcast
+func importFeed(cmd *cobra.Command, args []string) {
+	name, _ := cmd.Flags().GetString("name")
+	from, _ := cmd.Flags().GetString("from")
+	baseURL, _ := cmd.Flags().GetString("base-url")
+	audioDir, _ := cmd.Flags().GetString("audio-dir")
+
+	if err := validFeedName(name); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if _, exists := config.Feeds[name]; exists {
+		fmt.Printf("Feed '%s' already exists\n", name)
+		return
+	}
+	if _, exists := config.Podcasts[name]; exists {
+		fmt.Printf("Podcast '%s' already exists\n", name)
+		return
+	}
+
+	data, err := os.ReadFile(from)
+	if err != nil {
+		fmt.Printf("Failed to read feed document: %v\n", err)
+		return
+	}
+
+	feed, podcast, err := parseFeedDocument(data, true)
+	if err != nil {
+		fmt.Printf("Failed to parse feed document: %v\n", err)
+		return
+	}
+
+	if podcast != nil {
+		if baseURL == "" {
+			fmt.Println("The document is a podcast feed, --base-url is required to import it")
+			return
+		}
+		podcast.BaseURL = baseURL
+		podcast.AudioDir = audioDir
+		matched := 0
+		if audioDir != "" {
+			if matched, err = matchImportedFiles(podcast); err != nil {
+				fmt.Printf("Failed to scan audio files: %v\n", err)
+				return
+			}
+		}
+		config.Podcasts[name] = *podcast
+		saveConfig()
+		emitFeedEvent(eventFeedCreated, name, "podcast")
+		fmt.Printf("Podcast '%s' imported with %d episodes\n", name, len(podcast.Episodes))
+		if audioDir != "" {
+			fmt.Printf("%d episodes matched files in %s, the others stay on their original host\n", matched, audioDir)
+		}
+		return
+	}
+
+	config.Feeds[name] = *feed
+	saveConfig()
+	emitFeedEvent(eventFeedCreated, name, "feed")
+	fmt.Printf("Feed '%s' imported with %d entries\n", name, len(feed.Items))
+}
+
+// matchImportedFiles points imported episodes at their files in the podcast's audio
+// directory, matched by the file name of the enclosure URL. Matched episodes keep their
+// GUID, or their old enclosure URL as GUID, so podcast apps don't see them as new. Their
+// metadata is stored as episode details and their publication date as the file's
+// modification time, so later scans keep both. It returns how many episodes matched.
+func matchImportedFiles(podcast *Podcast) (int, error) {
+	scanned, err := scanAudioFiles(podcast.AudioDir, podcast.BaseURL)
+	if err != nil {
+		return 0, err
+	}
+	files := make(map[string]Episode)
+	for _, episode := range scanned {
+		files[filepath.Base(episode.FilePath)] = episode
+	}
+
+	matched := 0
+	for i, imported := range podcast.Episodes {
+		u, err := url.Parse(imported.AudioURL)
+		if err != nil {
+			continue
+		}
+		file, exists := files[path.Base(u.Path)]
+		if !exists {
+			continue
+		}
+		delete(files, path.Base(u.Path))
+
+		file.GUID = imported.GUID
+		if file.GUID == "" {
+			file.GUID = imported.AudioURL
+		}
+		file.Title, file.Description = imported.Title, imported.Description
+		file.Season, file.Episode = imported.Season, imported.Episode
+		if file.Duration == 0 {
+			file.Duration = imported.Duration
+		}
+		if file.ImageURL == "" {
+			file.ImageURL = imported.ImageURL
+		}
+		if !imported.Published.IsZero() {
+			if err := os.Chtimes(file.FilePath, time.Time{}, imported.Published); err != nil {
+				fmt.Printf("Note: failed to date %s, rescans will date it by its modification time: %v\n", file.FilePath, err)
+			}
+			file.Published = imported.Published
+		}
+
+		// Imported titles and descriptions are stored escaped like scanned ones
+		if podcast.EpisodeDetails == nil {
+			podcast.EpisodeDetails = make(map[string]EpisodeDetails)
+		}
+		podcast.EpisodeDetails[episodeFileKey(*podcast, file)] = EpisodeDetails{
+			Title:       html.UnescapeString(imported.Title),
+			Description: html.UnescapeString(imported.Description),
+			Season:      imported.Season,
+			Episode:     imported.Episode,
+		}
+
+		podcast.Episodes[i] = file
+		matched++
+	}
+
+	sort.SliceStable(podcast.Episodes, func(i, j int) bool {
+		return podcast.Episodes[i].Published.Before(podcast.Episodes[j].Published)
+	})
+	return matched, nil
+}
+
+// parseFeedDocument parses an RSS or Atom document. iTunes-style feeds are returned
+// as a podcast when allowPodcast is set, otherwise every document becomes a feed.
+func parseFeedDocument(data []byte, allowPodcast bool) (*Feed, *Podcast, error) {
+	root, err := rootElement(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case root.Local == "rss":
+		var doc rssDocument
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return nil, nil, err
+		}
+		if allowPodcast && isPodcastChannel(doc.Channel) {
+			return nil, rssToPodcast(doc.Channel), nil
+		}
+		return rssToFeed(doc.Channel), nil, nil
+	case root.Local == "feed" && root.Space == atomNamespace:
+		var doc atomDocument
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return nil, nil, err
+		}
+		return atomToFeed(doc), nil, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported document root <%s>, expected RSS 2.0 or Atom", root.Local)
+	}
+}
+
+// rootElement returns the name of the first element in an XML document
+func rootElement(data []byte) (xml.Name, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return xml.Name{}, fmt.Errorf("no root element found: %v", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+// isPodcastChannel reports whether an RSS channel carries iTunes metadata or audio enclosures
+func isPodcastChannel(channel rssChannel) bool {
+	if channel.ItunesAuthor != "" || channel.ItunesOwner.Email != "" || len(channel.ItunesCategories) > 0 {
+		return true
+	}
+	for _, image := range channel.Image {
+		if image.XMLName.Space == itunesNamespace {
+			return true
+		}
+	}
+	for _, item := range channel.Items {
+		if strings.HasPrefix(item.Enclosure.Type, "audio/") {
+			return true
+		}
+	}
+	return false
+}
+
+// rssToFeed maps an RSS channel onto a Feed
+func rssToFeed(channel rssChannel) *Feed {
+	author, email := parseRSSPerson(channel.ManagingEditor)
+	feed := &Feed{
+		Title:       rssValue(channel.Title),
+		Description: rssValue(channel.Description),
+		Link:        rssValue(channel.Link),
+		Author:      author,
+		Email:       email,
+		Items:       []Item{},
+	}
+
+	for _, rssItem := range channel.Items {
+		created := parseFeedTime(rssItem.PubDate)
+		item := Item{
+			Title:       rssValue(rssItem.Title),
+			Description: rssValue(rssItem.Description),
+			Content:     rssItem.Content,
+			Link:        rssValue(rssItem.Link),
+			GUID:        strings.TrimSpace(rssItem.GUID),
+			Categories:  rssItem.Categories,
+			Created:     created,
+			Updated:     created,
+		}
+		if item.Content == "" {
+			item.Content = item.Description
+		}
+		if strings.HasPrefix(rssItem.Enclosure.Type, "image/") {
+			item.ImageURL = rssItem.Enclosure.URL
+		}
+		feed.Items = append(feed.Items, item)
+	}
+
+	feed.Created, feed.Updated = feedDates(parseFeedTime(channel.PubDate), parseFeedTime(channel.LastBuildDate), feed.Items)
+	return feed
+}
+
+// rssToPodcast maps an iTunes-style RSS channel onto a Podcast
+func rssToPodcast(channel rssChannel) *Podcast {
+	author, email := parseRSSPerson(channel.ManagingEditor)
+	if channel.ItunesAuthor != "" {
+		author = channel.ItunesAuthor
+	} else if channel.ItunesOwner.Name != "" {
+		author = channel.ItunesOwner.Name
+	}
+	if channel.ItunesOwner.Email != "" {
+		email = channel.ItunesOwner.Email
+	}
+
+	imageURL := channelImage(channel)
+
+	var categories []string
+	for _, category := range channel.ItunesCategories {
+		categories = append(categories, category.Text)
+	}
+
+	explicit := strings.ToLower(strings.TrimSpace(channel.ItunesExplicit))
+	podcast := &Podcast{
+		Title:       rssValue(channel.Title),
+		Description: rssValue(channel.Description),
+		Link:        rssValue(channel.Link),
+		Author:      author,
+		Email:       email,
+		ImageURL:    imageURL,
+		Categories:  categories,
+		Language:    channel.Language,
+		Copyright:   channel.Copyright,
+		Explicit:    explicit == "yes" || explicit == "true" || explicit == "explicit",
+		Episodes:    []Episode{},
+	}
+
+	var latest time.Time
+	for _, item := range channel.Items {
+		if item.Enclosure.URL == "" {
+			continue
+		}
+		size, _ := strconv.ParseInt(item.Enclosure.Length, 10, 64)
+		season, _ := strconv.Atoi(strings.TrimSpace(item.ItunesSeason))
+		number, _ := strconv.Atoi(strings.TrimSpace(item.ItunesEpisode))
+		published := parseFeedTime(item.PubDate)
+		if published.After(latest) {
+			latest = published
+		}
+
+		mimeType := item.Enclosure.Type
+		if mimeType == "" {
+			mimeType = "audio/mpeg"
+		}
+
+		podcast.Episodes = append(podcast.Episodes, Episode{
+			Title:       html.EscapeString(rssValue(item.Title)),
+			Description: html.EscapeString(rssValue(item.Description)),
+			AudioURL:    item.Enclosure.URL,
+			Duration:    parseItunesDuration(item.ItunesDuration),
+			FileSize:    size,
+			MimeType:    mimeType,
+			Published:   published,
+			ImageURL:    item.ItunesImage.Href,
+			Season:      season,
+			Episode:     number,
+			GUID:        strings.TrimSpace(item.GUID),
+		})
+	}
+
+	// Episodes are kept oldest first, matching scanned podcasts
+	sort.SliceStable(podcast.Episodes, func(i, j int) bool {
+		return podcast.Episodes[i].Published.Before(podcast.Episodes[j].Published)
+	})
+
+	podcast.Created = parseFeedTime(channel.PubDate)
+	podcast.Updated = parseFeedTime(channel.LastBuildDate)
+	if podcast.Updated.IsZero() {
+		podcast.Updated = latest
+	}
+	if podcast.Updated.IsZero() {
+		podcast.Updated = time.Now()
+	}
+	if podcast.Created.IsZero() {
+		podcast.Created = podcast.Updated
+	}
+
+	return podcast
+}
+
+// atomToFeed maps an Atom document onto a Feed
+func atomToFeed(doc atomDocument) *Feed {
+	feed := &Feed{
+		Title:       doc.Title.String(),
+		Description: doc.Subtitle.String(),
+		Link:        atomAlternateLink(doc.Links),
+		Author:      doc.Author.Name,
+		Email:       doc.Author.Email,
+		Items:       []Item{},
+	}
+
+	for _, entry := range doc.Entries {
+		updated := parseFeedTime(entry.Updated)
+		created := parseFeedTime(entry.Published)
+		if created.IsZero() {
+			created = updated
+		}
+		if updated.IsZero() {
+			updated = created
+		}
+
+		item := Item{
+			Title:       entry.Title.String(),
+			Description: entry.Summary.String(),
+			Content:     entry.Content.String(),
+			Link:        atomAlternateLink(entry.Links),
+			GUID:        strings.TrimSpace(entry.ID),
+			Created:     created,
+			Updated:     updated,
+		}
+		if item.Description == "" {
+			item.Description = item.Content
+		}
+		if item.Content == "" {
+			item.Content = item.Description
+		}
+		for _, category := range entry.Categories {
+			item.Categories = append(item.Categories, category.Term)
+		}
+		for _, link := range entry.Links {
+			if link.Rel == "enclosure" && strings.HasPrefix(link.Type, "image/") {
+				item.ImageURL = link.Href
+				break
+			}
+		}
+		feed.Items = append(feed.Items, item)
+	}
+
+	feed.Created, feed.Updated = feedDates(time.Time{}, parseFeedTime(doc.Updated), feed.Items)
+	return feed
+}
+
+// atomAlternateLink picks the alternate (or first untyped) link from an Atom link list
+func atomAlternateLink(links []atomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+// parseRSSPerson splits an RSS person such as "jane@example.com (Jane Doe)" into name and email
+func parseRSSPerson(value string) (string, string) {
+	value = strings.TrimSpace(value)
+	if open := strings.Index(value, "("); open != -1 && strings.HasSuffix(value, ")") {
+		return strings.TrimSpace(value[open+1 : len(value)-1]), strings.TrimSpace(value[:open])
+	}
+	if strings.Contains(value, "@") {
+		return "", value
+	}
+	return value, ""
+}
+
+// parseFeedTime parses a feed timestamp, returning the zero time if it can't be read
+func parseFeedTime(value string) time.Time {
+	if strings.TrimSpace(value) == "" {
+		return time.Time{}
+	}
+	t, err := parseEntryTime(value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// parseItunesDuration parses an itunes:duration value (seconds, MM:SS or HH:MM:SS)
+func parseItunesDuration(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	var seconds int
+	for _, part := range strings.Split(value, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// feedDates fills in missing item and channel dates and orders items oldest first
+func feedDates(created, updated time.Time, items []Item) (time.Time, time.Time) {
+	// Undated items are stamped before sorting, so they land after the dated ones in
+	// document order
+	now := time.Now()
+	for i := range items {
+		if items[i].Created.IsZero() {
+			items[i].Created = now
+			items[i].Updated = now
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Created.Before(items[j].Created)
+	})
+
+	for i := range items {
+		if created.IsZero() || items[i].Created.Before(created) {
+			created = items[i].Created
+		}
+		if items[i].Updated.After(updated) {
+			updated = items[i].Updated
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	if created.IsZero() {
+		created = updated
+	}
+	return created, updated
+}
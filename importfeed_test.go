@@ -0,0 +1,61 @@
+// importfeed_test.go
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFeedDatesOrdersUndatedItemsLast(t *testing.T) {
+	older := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2023, 1, 3, 0, 0, 0, 0, time.UTC)
+	items := []Item{
+		{Title: "undated first"},
+		{Title: "newer", Created: newer, Updated: newer},
+		{Title: "undated second"},
+		{Title: "older", Created: older, Updated: older},
+	}
+
+	feedDates(time.Time{}, time.Time{}, items)
+
+	want := []string{"older", "newer", "undated first", "undated second"}
+	for i, title := range want {
+		if items[i].Title != title {
+			t.Fatalf("item %d is %q, want order %v", i, items[i].Title, want)
+		}
+	}
+}
+
+func TestSetPodcastEpisodesKeepsImportedEpisodes(t *testing.T) {
+	saved := config
+	t.Cleanup(func() { config = saved })
+
+	published := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	config = Config{Podcasts: map[string]Podcast{"show": {
+		AudioDir: "/audio",
+		Episodes: []Episode{
+			{Title: "Local", FilePath: "/audio/ep1.mp3", AudioURL: "https://feeds.example.com/show/audio/ep1.mp3", GUID: "original-1", Published: published},
+			{Title: "Remote", AudioURL: "https://old.example.com/ep2.mp3", GUID: "original-2", Published: published.Add(time.Hour)},
+		},
+	}}}
+
+	rescanned := []Episode{
+		{Title: "Local", FilePath: "/audio/ep1.mp3", AudioURL: "https://feeds.example.com/show/audio/ep1.mp3", Published: published},
+		{Title: "New", FilePath: "/audio/ep3.mp3", AudioURL: "https://feeds.example.com/show/audio/ep3.mp3", Published: published.Add(2 * time.Hour)},
+	}
+	added, err := setPodcastEpisodes("show", rescanned)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	episodes := config.Podcasts["show"].Episodes
+	if len(episodes) != 3 || len(added) != 1 || added[0].Title != "New" {
+		t.Fatalf("rescan stored %d episodes and added %v, want 3 and only the new file", len(episodes), added)
+	}
+	if episodes[0].GUID != "original-1" {
+		t.Errorf("rescanned file has GUID %q, want its previous GUID", episodes[0].GUID)
+	}
+	if episodes[1].Title != "Remote" || episodes[1].GUID != "original-2" {
+		t.Errorf("episode without a local file became %+v, want it kept", episodes[1])
+	}
+}
@@ -0,0 +1,108 @@
+// listen.go
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Prefix of listen addresses that are Unix socket paths, e.g. unix:/run/chopchop.sock
+const unixListenPrefix = "unix:"
+
+// Default permissions of Unix sockets, letting a reverse proxy in the same group connect
+const defaultSocketMode = "0660"
+
+// serveListeners opens the addresses serve accepts connections on: the sockets passed by
+// systemd, plus every --listen address, or :port when neither is given. It also returns
+// the TCP port of the first TCP listener, which ACME redirects to.
+func serveListeners(cmd *cobra.Command) ([]net.Listener, string, error) {
+	port, _ := cmd.Flags().GetString("port")
+	addrs, _ := cmd.Flags().GetStringSlice("listen")
+
+	if len(addrs) > 0 && cmd.Flags().Changed("port") {
+		return nil, "", fmt.Errorf("use either --port or --listen, not both")
+	}
+
+	listeners, err := systemdListeners()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(addrs) == 0 && len(listeners) == 0 {
+		addrs = []string{":" + port}
+	}
+
+	for _, addr := range addrs {
+		listener, err := listen(cmd, addr)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, "", err
+		}
+		listeners = append(listeners, listener)
+	}
+
+	tcpPort := port
+	for _, listener := range listeners {
+		if addr, ok := listener.Addr().(*net.TCPAddr); ok {
+			tcpPort = strconv.Itoa(addr.Port)
+			break
+		}
+	}
+	return listeners, tcpPort, nil
+}
+
+// listen opens a TCP address like 127.0.0.1:8090 or [::1]:8090, or a Unix socket given as
+// unix:/path. A stale socket left by a previous run is replaced.
+func listen(cmd *cobra.Command, addr string) (net.Listener, error) {
+	path, isUnix := strings.CutPrefix(addr, unixListenPrefix)
+	if !isUnix {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on %s: %v", addr, err)
+		}
+		return listener, nil
+	}
+
+	modeFlag, _ := cmd.Flags().GetString("socket-mode")
+	mode, err := strconv.ParseUint(modeFlag, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket mode '%s', use octal like 0660", modeFlag)
+	}
+
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket %s is in use by another process", path)
+		}
+		os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+	if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set permissions of %s: %v", path, err)
+	}
+	return listener, nil
+}
+
+// closeListeners closes listeners opened before a later one failed
+func closeListeners(listeners []net.Listener) {
+	for _, listener := range listeners {
+		listener.Close()
+	}
+}
+
+// listenerURL describes where a listener accepts connections, for the startup log
+func listenerURL(listener net.Listener, scheme string) string {
+	if listener.Addr().Network() == "unix" {
+		return unixListenPrefix + listener.Addr().String()
+	}
+	return scheme + "://" + listener.Addr().String()
+}
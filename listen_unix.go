@@ -0,0 +1,55 @@
+// listen_unix.go
+
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// First file descriptor passed by systemd socket activation
+const systemdFirstFD = 3
+
+// systemdListeners returns the sockets passed by systemd socket activation, if any.
+// See sd_listen_fds(3).
+func systemdListeners() ([]net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	// Don't pass the sockets on to child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	var listeners []net.Listener
+	for i := 0; i < count; i++ {
+		fd := systemdFirstFD + i
+		syscall.CloseOnExec(fd)
+
+		name := "systemd-socket-" + strconv.Itoa(i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(file)
+		file.Close() // FileListener keeps its own copy of the descriptor
+		if err != nil {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("socket %s passed by systemd is not a stream socket: %v", name, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
@@ -0,0 +1,12 @@
+// listen_windows.go
+
+//go:build windows
+
+package main
+
+import "net"
+
+// systemdListeners returns no listeners, since there is no socket activation on Windows
+func systemdListeners() ([]net.Listener, error) {
+	return nil, nil
+}
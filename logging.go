@@ -0,0 +1,328 @@
+// logging.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Access log formats accepted by serve --access-log-format
+const (
+	accessLogCombined = "combined"
+	accessLogJSON     = "json"
+	accessLogOff      = "off"
+)
+
+// Query parameters that carry credentials and are redacted from access logs
+var redactedParams = []string{"token", "sig"}
+
+// setupLogging installs the application logger for the --log-format and --log-level
+// flags. Output of the standard log package goes through it too.
+func setupLogging(cmd *cobra.Command) error {
+	format, _ := cmd.Flags().GetString("log-format")
+	levelName, _ := cmd.Flags().GetString("log-level")
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(levelName)); err != nil {
+		return fmt.Errorf("invalid log level '%s', use debug, info, warn or error", levelName)
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, options)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	default:
+		return fmt.Errorf("invalid log format '%s', use text or json", format)
+	}
+
+	slog.SetDefault(slog.New(&errorRecorder{Handler: handler, log: recentErrors}))
+	return nil
+}
+
+// Warnings and errors kept for the admin UI
+const recentErrorLimit = 100
+
+// recentErrors holds the latest warnings and errors logged, newest last
+var recentErrors = &errorLog{}
+
+// LoggedError is a warning or error from the application log
+type LoggedError struct {
+	Time    time.Time
+	Level   string
+	Message string
+	Attrs   string // key=value pairs
+}
+
+// errorLog is a ring of the latest logged warnings and errors
+type errorLog struct {
+	mu      sync.Mutex
+	entries []LoggedError
+}
+
+func (l *errorLog) add(entry LoggedError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, entry)
+	if len(l.entries) > recentErrorLimit {
+		l.entries = l.entries[len(l.entries)-recentErrorLimit:]
+	}
+}
+
+// list returns the recorded entries, newest first
+func (l *errorLog) list() []LoggedError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries := make([]LoggedError, len(l.entries))
+	for i, entry := range l.entries {
+		entries[len(entries)-1-i] = entry
+	}
+	return entries
+}
+
+// errorRecorder passes log records on to a handler, keeping warnings and errors in an errorLog
+type errorRecorder struct {
+	slog.Handler
+	log   *errorLog
+	attrs []slog.Attr
+}
+
+func (h *errorRecorder) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level >= slog.LevelWarn {
+		var attrs []string
+		for _, attr := range h.attrs {
+			attrs = append(attrs, attr.String())
+		}
+		record.Attrs(func(attr slog.Attr) bool {
+			attrs = append(attrs, attr.String())
+			return true
+		})
+		h.log.add(LoggedError{
+			Time:    record.Time,
+			Level:   record.Level.String(),
+			Message: record.Message,
+			Attrs:   strings.Join(attrs, " "),
+		})
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *errorRecorder) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &errorRecorder{Handler: h.Handler.WithAttrs(attrs), log: h.log, attrs: append(slices.Clip(h.attrs), attrs...)}
+}
+
+func (h *errorRecorder) WithGroup(name string) slog.Handler {
+	return &errorRecorder{Handler: h.Handler.WithGroup(name), log: h.log, attrs: h.attrs}
+}
+
+// fatal logs an error and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// envOrDefault returns the value of an environment variable, or fallback when it is unset
+func envOrDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// AccessLogEntry is one request in the access log
+type AccessLogEntry struct {
+	Time      time.Time `json:"time"`
+	Remote    string    `json:"remote"`
+	User      string    `json:"user,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+	Duration  float64   `json:"durationMs"`
+	Feed      string    `json:"feed,omitempty"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"userAgent,omitempty"`
+}
+
+// accessLogger writes one line per request in combined or JSON format
+type accessLogger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	format string
+}
+
+// feedNameKey is the context key under which the access log collects the feed name
+type feedNameKey struct{}
+
+// newAccessLogger opens the access log for serve. An empty path logs to stdout.
+func newAccessLogger(format, path string) (*accessLogger, error) {
+	switch format {
+	case accessLogCombined, accessLogJSON:
+	case accessLogOff:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("invalid access log format '%s', use combined, json or off", format)
+	}
+
+	var out io.Writer = os.Stdout
+	if path != "" {
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		out = file
+	}
+	return &accessLogger{out: out, format: format}, nil
+}
+
+// middleware logs every request handled by next. A nil logger logs nothing.
+func (logger *accessLogger) middleware(next http.Handler) http.Handler {
+	if logger == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		feed := new(string)
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), feedNameKey{}, feed)))
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		entry := AccessLogEntry{
+			Time:      start,
+			Remote:    remoteHost(r),
+			Method:    r.Method,
+			Path:      redactedRequestURI(r),
+			Proto:     r.Proto,
+			Status:    rec.status,
+			Bytes:     rec.bytes,
+			Duration:  float64(time.Since(start).Microseconds()) / 1000,
+			Feed:      *feed,
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+		}
+		if username, _, ok := r.BasicAuth(); ok {
+			entry.User = username
+		}
+		logger.write(entry)
+	})
+}
+
+// Close closes the access log file, if there is one
+func (logger *accessLogger) Close() error {
+	if logger == nil {
+		return nil
+	}
+	if file, ok := logger.out.(*os.File); ok && file != os.Stdout {
+		return file.Close()
+	}
+	return nil
+}
+
+// write appends an entry to the access log
+func (logger *accessLogger) write(entry AccessLogEntry) {
+	var line []byte
+	if logger.format == accessLogJSON {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			slog.Error("Failed to encode access log entry", "error", err)
+			return
+		}
+		line = append(data, '\n')
+	} else {
+		line = []byte(combinedLogLine(entry))
+	}
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	if _, err := logger.out.Write(line); err != nil {
+		slog.Error("Failed to write access log", "error", err)
+	}
+}
+
+// combinedLogLine formats an entry in the Apache combined log format, followed by the
+// feed name and the request duration in milliseconds
+func combinedLogLine(entry AccessLogEntry) string {
+	bytes := "-"
+	if entry.Bytes > 0 {
+		bytes = strconv.FormatInt(entry.Bytes, 10)
+	}
+	return fmt.Sprintf("%s - %s [%s] %s %d %s %s %s %s %.3f\n",
+		entry.Remote,
+		dashIfEmpty(entry.User),
+		entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(entry.Method+" "+entry.Path+" "+entry.Proto),
+		entry.Status,
+		bytes,
+		strconv.Quote(dashIfEmpty(entry.Referer)),
+		strconv.Quote(dashIfEmpty(entry.UserAgent)),
+		strconv.Quote(dashIfEmpty(entry.Feed)),
+		entry.Duration,
+	)
+}
+
+// dashIfEmpty returns "-" for empty access log fields
+func dashIfEmpty(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// Size at which the webhook delivery and subscriber access logs are rotated, keeping one
+// previous file next to them with a .1 suffix
+const maxLogSize = 10 << 20
+
+// rotateLog moves a log that has grown to maxLogSize aside, replacing the previous one.
+// Callers must hold the mutex guarding the log.
+func rotateLog(path string) error {
+	if info, err := os.Stat(path); err != nil || info.Size() < maxLogSize {
+		return nil
+	}
+	return os.Rename(path, path+".1")
+}
+
+// redactedRequestURI returns the request URI with subscriber tokens and media signatures
+// removed, so access logs don't leak credentials
+func redactedRequestURI(r *http.Request) string {
+	if r.URL.RawQuery == "" {
+		return r.URL.RequestURI()
+	}
+
+	query := r.URL.Query()
+	for _, param := range redactedParams {
+		if query.Has(param) {
+			query.Set(param, "REDACTED")
+		}
+	}
+	u := url.URL{Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: query.Encode()}
+	return u.RequestURI()
+}
+
+// logFeedName records which feed or podcast a handler serves in the access log
+func logFeedName(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if feed, ok := r.Context().Value(feedNameKey{}).(*string); ok {
+			*feed = name
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -2,41 +2,60 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"html"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/dhowden/tag"
 	"github.com/gorilla/feeds"
 	"github.com/gorilla/mux"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 // Config represents the application configuration
 type Config struct {
-	Feeds    map[string]Feed    `json:"feeds"`
-	Podcasts map[string]Podcast `json:"podcasts"`
+	Feeds      map[string]Feed    `json:"feeds"`
+	Podcasts   map[string]Podcast `json:"podcasts"`
+	Webhooks   []Webhook          `json:"webhooks,omitempty"`
+	WebSub     *WebSubConfig      `json:"websub,omitempty"`
+	MediaKey   string             `json:"mediaKey,omitempty"`   // Key for signed enclosure URLs
+	AdminUsers []BasicUser        `json:"adminUsers,omitempty"` // Who may sign in to the web admin UI
+	PublicURL  string             `json:"publicUrl,omitempty"`  // Base URL readers reach the server at
 }
 
 // Feed represents an RSS feed
 type Feed struct {
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Link        string    `json:"link"`
-	Author      string    `json:"author"`
-	Email       string    `json:"email"`
-	Created     time.Time `json:"created"`
-	Updated     time.Time `json:"updated"`
-	Items       []Item    `json:"items"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Link        string        `json:"link"`
+	Author      string        `json:"author"`
+	Email       string        `json:"email"`
+	Created     time.Time     `json:"created"`
+	Updated     time.Time     `json:"updated"`
+	Items       []Item        `json:"items"`
+	Remote      *Remote       `json:"remote,omitempty"`      // Set for feeds mirrored from another site
+	Composite   *Composite    `json:"composite,omitempty"`   // Set for feeds merged from other feeds
+	Rules       []Rule        `json:"rules,omitempty"`       // Filters and rewrites applied when serving
+	Private     bool          `json:"private,omitempty"`     // Only readable with a subscriber token
+	Subscribers []Subscriber  `json:"subscribers,omitempty"` // Who may read the feed when private
+	Access      *AccessPolicy `json:"access,omitempty"`      // HTTP Basic credentials and network allowlist
 }
 
 // Item represents an RSS feed item
@@ -48,25 +67,38 @@ type Item struct {
 	Created     time.Time `json:"created"`
 	Updated     time.Time `json:"updated"`
 	ImageURL    string    `json:"imageUrl,omitempty"`
+	GUID        string    `json:"guid,omitempty"`
+	Source      string    `json:"source,omitempty"`      // URL of the feed the item originally came from
+	SourceTitle string    `json:"sourceTitle,omitempty"` // Title of that feed
+	Categories  []string  `json:"categories,omitempty"`
+	Markdown    string    `json:"markdown,omitempty"` // Source of the content for entries written in the admin UI
 }
 
 // Podcast represents a podcast feed configuration
 type Podcast struct {
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Link        string    `json:"link"`
-	Author      string    `json:"author"`
-	Email       string    `json:"email"`
-	ImageURL    string    `json:"imageUrl,omitempty"`
-	Categories  []string  `json:"categories,omitempty"`
-	Language    string    `json:"language,omitempty"`
-	Copyright   string    `json:"copyright,omitempty"`
-	Explicit    bool      `json:"explicit,omitempty"`
-	BaseURL     string    `json:"baseUrl"`  // Base URL for serving audio files
-	AudioDir    string    `json:"audioDir"` // Directory containing audio files
-	Created     time.Time `json:"created"`
-	Updated     time.Time `json:"updated"`
-	Episodes    []Episode `json:"episodes"`
+	Title        string        `json:"title"`
+	Description  string        `json:"description"`
+	Link         string        `json:"link"`
+	Author       string        `json:"author"`
+	Email        string        `json:"email"`
+	ImageURL     string        `json:"imageUrl,omitempty"`
+	Categories   []string      `json:"categories,omitempty"`
+	Language     string        `json:"language,omitempty"`
+	Copyright    string        `json:"copyright,omitempty"`
+	Explicit     bool          `json:"explicit,omitempty"`
+	BaseURL      string        `json:"baseUrl"`  // Base URL for serving audio files
+	AudioDir     string        `json:"audioDir"` // Directory containing audio files
+	Created      time.Time     `json:"created"`
+	Updated      time.Time     `json:"updated"`
+	Episodes     []Episode     `json:"episodes"`
+	Private      bool          `json:"private,omitempty"`      // Only readable with a subscriber token
+	Subscribers  []Subscriber  `json:"subscribers,omitempty"`  // Who may read the podcast when private
+	Access       *AccessPolicy `json:"access,omitempty"`       // HTTP Basic credentials and network allowlist
+	SignedURLTTL time.Duration `json:"signedUrlTtl,omitempty"` // Lifetime of signed enclosure URLs, 0 when unsigned
+	LastScan     time.Time     `json:"lastScan,omitempty"`     // When the audio directory was last scanned
+	ScanError    string        `json:"scanError,omitempty"`    // Why the last scan failed, empty when it succeeded
+
+	EpisodeDetails map[string]EpisodeDetails `json:"episodeDetails,omitempty"` // Uploaded metadata by audio file path
 }
 
 // Episode represents a podcast episode
@@ -82,6 +114,7 @@ type Episode struct {
 	ImageURL    string        `json:"imageUrl,omitempty"`
 	Season      int           `json:"season,omitempty"`
 	Episode     int           `json:"episode,omitempty"`
+	GUID        string        `json:"guid,omitempty"`
 }
 
 // StartupConfig represents the startup configuration for auto-creating podcasts
@@ -91,47 +124,68 @@ type StartupConfig struct {
 
 // StartupPodcast represents a podcast configuration for auto-setup
 type StartupPodcast struct {
-	Name        string `json:"name"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Link        string `json:"link,omitempty"`
-	Author      string `json:"author,omitempty"`
-	Email       string `json:"email,omitempty"`
-	ImageURL    string `json:"imageUrl,omitempty"`
-	Categories  []string `json:"categories,omitempty"`
-	Language    string `json:"language,omitempty"`
-	Copyright   string `json:"copyright,omitempty"`
-	Explicit    bool   `json:"explicit,omitempty"`
-	BaseURL     string `json:"baseUrl"`
-	AudioDir    string `json:"audioDir"`
+	Name            string        `json:"name"`
+	Title           string        `json:"title"`
+	Description     string        `json:"description"`
+	Link            string        `json:"link,omitempty"`
+	Author          string        `json:"author,omitempty"`
+	Email           string        `json:"email,omitempty"`
+	ImageURL        string        `json:"imageUrl,omitempty"`
+	Categories      []string      `json:"categories,omitempty"`
+	Language        string        `json:"language,omitempty"`
+	Copyright       string        `json:"copyright,omitempty"`
+	Explicit        bool          `json:"explicit,omitempty"`
+	BaseURL         string        `json:"baseUrl"`
+	AudioDir        string        `json:"audioDir"`
+	Users           []StartupUser `json:"users,omitempty"`           // HTTP Basic credentials
+	AllowedNetworks []string      `json:"allowedNetworks,omitempty"` // CIDR ranges allowed to connect
 }
 
+// errFeedNotFound is returned when rendering a feed or podcast that doesn't exist
+var errFeedNotFound = errors.New("feed not found")
+
 var (
 	cfgFile     string
 	defaultPort = "8090"
 	config      Config
+	configMu    sync.RWMutex // Guards config while the server is running
 )
 
 func main() {
 	// Create config directory if it doesn't exist
 	configDir := getConfigDir()
 	if err := os.MkdirAll(configDir, 0755); err != nil {
-		log.Fatalf("Failed to create config directory: %v", err)
+		fatal("Failed to create config directory", "error", err)
 	}
 
 	cfgFile = filepath.Join(configDir, "config.json")
-	loadConfig()
-	
-	// Auto-setup podcasts from startup config if it exists
-	autoSetupPodcasts(configDir)
 
 	// Define root command
 	var rootCmd = &cobra.Command{
 		Use:   "chopchoprss",
 		Short: "ChopChopRSS is a simple CLI tool for managing RSS feeds",
 		Long:  `A CLI tool that lets you create and manage multiple RSS feeds with custom content.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := setupLogging(cmd); err != nil {
+				return err
+			}
+
+			// The healthcheck probe runs every few seconds and only talks to the server,
+			// so it must not load or rewrite the config
+			if cmd.Name() == "healthcheck" {
+				return nil
+			}
+			loadConfig()
+
+			// Auto-setup podcasts from startup config if it exists
+			autoSetupPodcasts(configDir)
+			return nil
+		},
 	}
 
+	rootCmd.PersistentFlags().String("log-format", envOrDefault("CHOPCHOP_LOG_FORMAT", "text"), "Log format: text or json")
+	rootCmd.PersistentFlags().String("log-level", envOrDefault("CHOPCHOP_LOG_LEVEL", "info"), "Log level: debug, info, warn or error")
+
 	// Create feed command
 	var createFeedCmd = &cobra.Command{
 		Use:   "create-feed",
@@ -164,6 +218,362 @@ func main() {
 	createEntryCmd.MarkFlagRequired("title")
 	createEntryCmd.MarkFlagRequired("content")
 
+	// Import entries command
+	var importEntriesCmd = &cobra.Command{
+		Use:   "import-entries",
+		Short: "Bulk import entries into a feed from a JSON Lines or CSV file",
+		Run:   importEntries,
+	}
+
+	importEntriesCmd.Flags().StringP("feed", "f", "", "Feed name (required)")
+	importEntriesCmd.Flags().String("file", "", "Path to a .jsonl or .csv file (required)")
+	importEntriesCmd.Flags().String("format", "", "Input format: jsonl or csv (default: detected from file extension)")
+	importEntriesCmd.MarkFlagRequired("feed")
+	importEntriesCmd.MarkFlagRequired("file")
+
+	// Import feed command
+	var importFeedCmd = &cobra.Command{
+		Use:   "import-feed",
+		Short: "Import an existing RSS or Atom document as a feed or podcast",
+		Run:   importFeed,
+	}
+
+	importFeedCmd.Flags().StringP("name", "n", "", "Feed or podcast name (required)")
+	importFeedCmd.Flags().String("from", "", "Path to the RSS or Atom document (required)")
+	importFeedCmd.Flags().StringP("base-url", "u", "", "Base URL for podcast feeds (required when importing a podcast)")
+	importFeedCmd.Flags().StringP("audio-dir", "r", "", "Directory containing the podcast's audio files (optional)")
+	importFeedCmd.MarkFlagRequired("name")
+	importFeedCmd.MarkFlagRequired("from")
+
+	// Create remote feed command
+	var createRemoteFeedCmd = &cobra.Command{
+		Use:   "create-remote-feed",
+		Short: "Create a feed that mirrors an external RSS or Atom feed",
+		Run:   createRemoteFeed,
+	}
+
+	createRemoteFeedCmd.Flags().StringP("name", "n", "", "Feed name (required)")
+	createRemoteFeedCmd.Flags().StringP("url", "u", "", "URL of the feed to mirror (required)")
+	createRemoteFeedCmd.Flags().DurationP("interval", "i", defaultRemoteInterval, "How often serve polls the remote feed")
+	createRemoteFeedCmd.Flags().StringP("title", "t", "", "Feed title (default: the remote feed's title)")
+	createRemoteFeedCmd.Flags().Int("max-items", defaultRemoteMaxItems, "Number of items kept, oldest are dropped first")
+	createRemoteFeedCmd.MarkFlagRequired("name")
+	createRemoteFeedCmd.MarkFlagRequired("url")
+
+	// Create composite feed command
+	var createCompositeFeedCmd = &cobra.Command{
+		Use:   "create-composite-feed",
+		Short: "Create a feed that merges the items of several feeds",
+		Run:   createCompositeFeed,
+	}
+
+	createCompositeFeedCmd.Flags().StringP("name", "n", "", "Feed name (required)")
+	createCompositeFeedCmd.Flags().StringP("title", "t", "", "Feed title (required)")
+	createCompositeFeedCmd.Flags().StringP("description", "d", "", "Feed description")
+	createCompositeFeedCmd.Flags().StringP("link", "l", "", "Feed link")
+	createCompositeFeedCmd.Flags().StringArrayP("member", "m", []string{}, "Member feed, optionally with a title prefix: name or name=prefix (repeatable)")
+	createCompositeFeedCmd.Flags().Int("limit", 0, "Maximum number of items in the merged feed (0 for no limit)")
+	createCompositeFeedCmd.MarkFlagRequired("name")
+	createCompositeFeedCmd.MarkFlagRequired("title")
+	createCompositeFeedCmd.MarkFlagRequired("member")
+
+	// Add rule command
+	var addRuleCmd = &cobra.Command{
+		Use:   "add-rule",
+		Short: "Add a filtering or rewriting rule to a feed",
+		Long: `Add a rule that filters or rewrites a feed's items before it is served.
+Rules run in the order they were added.
+
+Actions:
+  include       keep only items whose --field matches --pattern
+  exclude       drop items whose --field matches --pattern
+  rewrite-host  replace the host of item links (--from, --to)
+  strip-params  remove tracking query parameters from item links (--params, default utm_*, fbclid, ...)
+  truncate      shorten item content to --length characters`,
+		Run: addRule,
+	}
+
+	addRuleCmd.Flags().StringP("feed", "f", "", "Feed name (required)")
+	addRuleCmd.Flags().StringP("action", "a", "", "Rule action: include, exclude, rewrite-host, strip-params or truncate (required)")
+	addRuleCmd.Flags().String("field", "title", "Field to match: title, content, link or category")
+	addRuleCmd.Flags().StringP("pattern", "p", "", "Regular expression to match")
+	addRuleCmd.Flags().String("from", "", "Link host to rewrite")
+	addRuleCmd.Flags().String("to", "", "Replacement link host")
+	addRuleCmd.Flags().StringSlice("params", []string{}, "Query parameters to strip, a trailing * matches a prefix")
+	addRuleCmd.Flags().Int("length", 0, "Maximum content length in characters")
+	addRuleCmd.MarkFlagRequired("feed")
+	addRuleCmd.MarkFlagRequired("action")
+
+	// List rules command
+	var listRulesCmd = &cobra.Command{
+		Use:   "list-rules",
+		Short: "List the rules of a feed",
+		Run:   listRules,
+	}
+
+	listRulesCmd.Flags().StringP("feed", "f", "", "Feed name (required)")
+	listRulesCmd.MarkFlagRequired("feed")
+
+	// Delete rule command
+	var deleteRuleCmd = &cobra.Command{
+		Use:   "delete-rule",
+		Short: "Delete a rule from a feed",
+		Run:   deleteRule,
+	}
+
+	deleteRuleCmd.Flags().StringP("feed", "f", "", "Feed name (required)")
+	deleteRuleCmd.Flags().IntP("index", "i", -1, "Rule index (required)")
+	deleteRuleCmd.MarkFlagRequired("feed")
+	deleteRuleCmd.MarkFlagRequired("index")
+
+	// Test rules command
+	var testRulesCmd = &cobra.Command{
+		Use:   "test-rules",
+		Short: "Show which items each rule of a feed matches",
+		Run:   testRules,
+	}
+
+	testRulesCmd.Flags().StringP("feed", "f", "", "Feed name (required)")
+	testRulesCmd.MarkFlagRequired("feed")
+
+	// Add webhook command
+	var addWebhookCmd = &cobra.Command{
+		Use:   "add-webhook",
+		Short: "Notify a URL with signed JSON payloads when content changes",
+		Long: `Notify a URL with signed JSON payloads when content changes.
+
+Events: entry.created, entry.updated, entry.deleted, podcast.refreshed, feed.created, feed.deleted
+
+Each request carries an X-ChopChop-Signature header with the HMAC-SHA256 of the body,
+keyed with the webhook secret: "sha256=<hex digest>".`,
+		Run: addWebhook,
+	}
+
+	addWebhookCmd.Flags().StringP("url", "u", "", "Webhook URL (required)")
+	addWebhookCmd.Flags().StringP("secret", "s", "", "Signing secret (default: randomly generated)")
+	addWebhookCmd.Flags().StringSliceP("events", "e", []string{}, "Events to deliver (default: all events)")
+	addWebhookCmd.MarkFlagRequired("url")
+
+	// List webhooks command
+	var listWebhooksCmd = &cobra.Command{
+		Use:   "list-webhooks",
+		Short: "List all webhooks",
+		Run:   listWebhooks,
+	}
+
+	// Delete webhook command
+	var deleteWebhookCmd = &cobra.Command{
+		Use:   "delete-webhook",
+		Short: "Delete a webhook",
+		Run:   deleteWebhook,
+	}
+
+	deleteWebhookCmd.Flags().IntP("index", "i", -1, "Webhook index (required)")
+	deleteWebhookCmd.MarkFlagRequired("index")
+
+	// Webhook delivery log command
+	var webhookLogCmd = &cobra.Command{
+		Use:   "webhook-log",
+		Short: "Show recent webhook delivery attempts",
+		Run:   webhookLog,
+	}
+
+	webhookLogCmd.Flags().IntP("limit", "l", 20, "Number of deliveries to show (0 for all)")
+
+	// Configure WebSub command
+	var configureWebSubCmd = &cobra.Command{
+		Use:   "configure-websub",
+		Short: "Advertise a WebSub hub in feeds and notify it when content changes",
+		Run:   configureWebSub,
+	}
+
+	configureWebSubCmd.Flags().String("public-url", "", "Public base URL of the server, e.g. https://feeds.example.com")
+	configureWebSubCmd.Flags().String("hub", "", "External hub URL to ping on changes")
+	configureWebSubCmd.Flags().Bool("builtin", false, "Use the built-in hub at /websub")
+	configureWebSubCmd.Flags().Bool("disable", false, "Turn WebSub off")
+
+	// Set public URL command
+	var setPublicURLCmd = &cobra.Command{
+		Use:   "set-public-url",
+		Short: "Set the base URL readers reach the server at, used for subscriber feed URLs",
+		Run:   setPublicURL,
+	}
+
+	setPublicURLCmd.Flags().String("url", "", "Public base URL of the server, e.g. https://feeds.example.com")
+	setPublicURLCmd.Flags().Bool("clear", false, "Forget the public URL")
+
+	// Set private command
+	var setPrivateCmd = &cobra.Command{
+		Use:   "set-private",
+		Short: "Require a subscriber token to read a feed or podcast",
+		Run:   setPrivate,
+	}
+
+	setPrivateCmd.Flags().StringP("name", "n", "", "Feed or podcast name (required)")
+	setPrivateCmd.Flags().Bool("disable", false, "Make the feed or podcast public again")
+	setPrivateCmd.MarkFlagRequired("name")
+
+	// Create subscriber command
+	var createSubscriberCmd = &cobra.Command{
+		Use:   "create-subscriber",
+		Short: "Issue a personal feed URL for a private feed or podcast",
+		Run:   createSubscriber,
+	}
+
+	createSubscriberCmd.Flags().StringP("feed", "f", "", "Feed or podcast name (required)")
+	createSubscriberCmd.Flags().StringP("name", "n", "", "Subscriber name (required)")
+	createSubscriberCmd.MarkFlagRequired("feed")
+	createSubscriberCmd.MarkFlagRequired("name")
+
+	// Revoke subscriber command
+	var revokeSubscriberCmd = &cobra.Command{
+		Use:   "revoke-subscriber",
+		Short: "Revoke a subscriber's access to a private feed or podcast",
+		Run:   revokeSubscriber,
+	}
+
+	revokeSubscriberCmd.Flags().StringP("feed", "f", "", "Feed or podcast name (required)")
+	revokeSubscriberCmd.Flags().StringP("name", "n", "", "Subscriber name (required)")
+	revokeSubscriberCmd.MarkFlagRequired("feed")
+	revokeSubscriberCmd.MarkFlagRequired("name")
+
+	// List subscribers command
+	var listSubscribersCmd = &cobra.Command{
+		Use:   "list-subscribers",
+		Short: "List the subscribers of a feed or podcast",
+		Run:   listSubscribers,
+	}
+
+	listSubscribersCmd.Flags().StringP("feed", "f", "", "Feed or podcast name (required)")
+	listSubscribersCmd.MarkFlagRequired("feed")
+
+	// Subscriber access log command
+	var subscriberLogCmd = &cobra.Command{
+		Use:   "subscriber-log",
+		Short: "Show recent requests made with subscriber tokens",
+		Run:   subscriberLog,
+	}
+
+	subscriberLogCmd.Flags().StringP("feed", "f", "", "Only show requests for this feed or podcast")
+	subscriberLogCmd.Flags().StringP("name", "n", "", "Only show requests by this subscriber")
+	subscriberLogCmd.Flags().IntP("limit", "l", 20, "Number of requests to show (0 for all)")
+
+	// Sign enclosures command
+	var signEnclosuresCmd = &cobra.Command{
+		Use:   "sign-enclosures",
+		Short: "Serve a podcast's audio only through signed, expiring enclosure URLs",
+		Run:   signEnclosures,
+	}
+
+	signEnclosuresCmd.Flags().StringP("name", "n", "", "Podcast name (required)")
+	signEnclosuresCmd.Flags().Duration("ttl", defaultSignedURLTTL, "How long each enclosure URL stays valid")
+	signEnclosuresCmd.Flags().Bool("disable", false, "Serve audio unsigned again")
+	signEnclosuresCmd.MarkFlagRequired("name")
+
+	// Stats command
+	var statsCmd = &cobra.Command{
+		Use:   "stats",
+		Short: "Show podcast downloads per episode, per day and per app",
+		Run:   stats,
+	}
+
+	statsCmd.Flags().StringP("name", "n", "", "Podcast name (all podcasts when omitted)")
+	statsCmd.Flags().IntP("days", "d", 30, "Number of days to include (0 for all time)")
+
+	// Add feed user command
+	var addFeedUserCmd = &cobra.Command{
+		Use:   "add-feed-user",
+		Short: "Require HTTP Basic credentials for a feed or podcast, or change a user's password",
+		Run:   addFeedUser,
+	}
+
+	addFeedUserCmd.Flags().StringP("feed", "f", "", "Feed or podcast name (required)")
+	addFeedUserCmd.Flags().StringP("username", "u", "", "Username (required)")
+	addFeedUserCmd.Flags().Bool("password-stdin", false, "Read the password from the first line of standard input (generated and printed when omitted)")
+	addFeedUserCmd.Flags().StringP("password", "p", "", "Password, visible to other users of the machine")
+	addFeedUserCmd.Flags().MarkDeprecated("password", "use --password-stdin instead, command lines are visible to other users of the machine")
+	addFeedUserCmd.MarkFlagRequired("feed")
+	addFeedUserCmd.MarkFlagRequired("username")
+
+	// Remove feed user command
+	var removeFeedUserCmd = &cobra.Command{
+		Use:   "remove-feed-user",
+		Short: "Remove HTTP Basic credentials from a feed or podcast",
+		Run:   removeFeedUser,
+	}
+
+	removeFeedUserCmd.Flags().StringP("feed", "f", "", "Feed or podcast name (required)")
+	removeFeedUserCmd.Flags().StringP("username", "u", "", "Username (required)")
+	removeFeedUserCmd.MarkFlagRequired("feed")
+	removeFeedUserCmd.MarkFlagRequired("username")
+
+	// Add admin user command
+	var addAdminUserCmd = &cobra.Command{
+		Use:   "add-admin-user",
+		Short: "Let a user sign in to the web admin UI at /admin, or change their password",
+		Run:   addAdminUser,
+	}
+
+	addAdminUserCmd.Flags().StringP("username", "u", "", "Username (required)")
+	addAdminUserCmd.Flags().Bool("password-stdin", false, "Read the password from the first line of standard input (generated and printed when omitted)")
+	addAdminUserCmd.Flags().StringP("password", "p", "", "Password, visible to other users of the machine")
+	addAdminUserCmd.Flags().MarkDeprecated("password", "use --password-stdin instead, command lines are visible to other users of the machine")
+	addAdminUserCmd.MarkFlagRequired("username")
+
+	// Remove admin user command
+	var removeAdminUserCmd = &cobra.Command{
+		Use:   "remove-admin-user",
+		Short: "Remove a user from the web admin UI",
+		Run:   removeAdminUser,
+	}
+
+	removeAdminUserCmd.Flags().StringP("username", "u", "", "Username (required)")
+	removeAdminUserCmd.MarkFlagRequired("username")
+
+	// Allow network command
+	var allowNetworkCmd = &cobra.Command{
+		Use:   "allow-network",
+		Short: "Only serve a feed or podcast to addresses in the allowed networks",
+		Run:   allowNetwork,
+	}
+
+	allowNetworkCmd.Flags().StringP("feed", "f", "", "Feed or podcast name (required)")
+	allowNetworkCmd.Flags().StringP("cidr", "c", "", "CIDR range or IP address, e.g. 10.0.0.0/8 (required)")
+	allowNetworkCmd.MarkFlagRequired("feed")
+	allowNetworkCmd.MarkFlagRequired("cidr")
+
+	// Remove network command
+	var removeNetworkCmd = &cobra.Command{
+		Use:   "remove-network",
+		Short: "Remove a network from the allowlist of a feed or podcast",
+		Run:   removeNetwork,
+	}
+
+	removeNetworkCmd.Flags().StringP("feed", "f", "", "Feed or podcast name (required)")
+	removeNetworkCmd.Flags().StringP("cidr", "c", "", "CIDR range or IP address (required)")
+	removeNetworkCmd.MarkFlagRequired("feed")
+	removeNetworkCmd.MarkFlagRequired("cidr")
+
+	// Show access command
+	var showAccessCmd = &cobra.Command{
+		Use:   "show-access",
+		Short: "Show who can read a feed or podcast",
+		Run:   showAccess,
+	}
+
+	showAccessCmd.Flags().StringP("feed", "f", "", "Feed or podcast name (required)")
+	showAccessCmd.MarkFlagRequired("feed")
+
+	// Refresh remote feed command
+	var refreshRemoteFeedCmd = &cobra.Command{
+		Use:   "refresh-remote-feed",
+		Short: "Fetch a mirrored feed now instead of waiting for serve to poll it",
+		Run:   refreshRemoteFeed,
+	}
+
+	refreshRemoteFeedCmd.Flags().StringP("name", "n", "", "Feed name (required)")
+	refreshRemoteFeedCmd.MarkFlagRequired("name")
+
 	// List feeds command
 	var listFeedsCmd = &cobra.Command{
 		Use:   "list-feeds",
@@ -179,6 +589,45 @@ func main() {
 	}
 
 	serveCmd.Flags().StringP("port", "p", defaultPort, "Server port")
+	serveCmd.Flags().StringSlice("listen", nil, "Address to listen on instead of :port, e.g. 127.0.0.1:8090, [::1]:8090 or unix:/run/chopchop.sock (repeatable)")
+	serveCmd.Flags().String("socket-mode", defaultSocketMode, "Permissions of Unix sockets")
+	serveCmd.Flags().String("metrics-listen", "", "Serve /metrics on a separate address, e.g. 127.0.0.1:9100 or unix:/run/chopchop-metrics.sock")
+	serveCmd.Flags().String("access-log-format", accessLogCombined, "Access log format: combined, json or off")
+	serveCmd.Flags().String("access-log", "", "Append access logs to this file instead of stdout")
+	serveCmd.Flags().String("theme-dir", "", "Directory of templates and assets overriding the built-in theme (default <config dir>/theme when it exists)")
+	serveCmd.Flags().Bool("feed-stylesheet", false, "Link feeds to a stylesheet so browsers show a readable page with subscribe instructions")
+	serveCmd.Flags().Duration("read-header-timeout", defaultReadHeaderTimeout, "Time allowed to read request headers")
+	serveCmd.Flags().Duration("read-timeout", defaultReadTimeout, "Time allowed to read a whole request")
+	serveCmd.Flags().Duration("write-timeout", 0, "Time allowed to write a response (0 for none, so long downloads aren't cut off)")
+	serveCmd.Flags().Duration("idle-timeout", defaultIdleTimeout, "Time to keep idle keep-alive connections open")
+	serveCmd.Flags().Duration("shutdown-timeout", defaultShutdownTimeout, "Time open requests get to finish on SIGINT or SIGTERM")
+	serveCmd.Flags().Float64("rate-limit", 0, "Feed and media requests per second allowed per client IP (0 for unlimited)")
+	serveCmd.Flags().Int("rate-burst", 20, "Requests a client IP can make at once before --rate-limit applies")
+	serveCmd.Flags().Int("max-downloads-per-ip", 0, "Audio downloads a client IP can have open at once (0 for unlimited)")
+	serveCmd.Flags().String("audio-bandwidth-per-ip", "", "Audio bandwidth per client IP per second, e.g. 512K or 2M (unlimited when empty)")
+	serveCmd.Flags().String("audio-bandwidth", "", "Total audio bandwidth per second, e.g. 10M (unlimited when empty)")
+	serveCmd.Flags().StringSlice("trusted-proxy", nil, "Take client addresses from X-Forwarded-For or Forwarded on requests from this proxy: a CIDR range, an address, or unix for Unix sockets (repeatable)")
+	serveCmd.Flags().String("tls-cert", "", "Serve HTTPS with this certificate file (PEM, full chain)")
+	serveCmd.Flags().String("tls-key", "", "Private key file for --tls-cert")
+	serveCmd.Flags().StringSlice("acme-domain", nil, "Serve HTTPS with automatic certificates for this domain (repeatable)")
+	serveCmd.Flags().String("acme-email", "", "Contact email for the ACME account")
+	serveCmd.Flags().String("acme-cache", "", "Directory for ACME certificates and keys (default <config dir>/acme)")
+	serveCmd.Flags().String("acme-directory", autocert.DefaultACMEDirectory, "ACME directory URL, e.g. a staging or test CA")
+	serveCmd.Flags().String("acme-ca-cert", "", "CA certificate to trust when talking to the ACME directory, e.g. Pebble's")
+	serveCmd.Flags().String("acme-http-listen", defaultACMEHTTPListen, "Address for HTTP-01 challenges and redirects to HTTPS")
+
+	// Healthcheck command
+	var healthcheckCmd = &cobra.Command{
+		Use:   "healthcheck",
+		Short: "Check that a running server is ready, exiting non-zero if not",
+		Run:   healthcheck,
+	}
+
+	healthcheckCmd.Flags().StringP("port", "p", defaultPort, "Port the server listens on")
+	healthcheckCmd.Flags().String("url", "", "Readiness URL to probe (overrides --port)")
+	healthcheckCmd.Flags().Duration("timeout", defaultHealthcheckTimeout, "Time to wait for the server")
+	healthcheckCmd.Flags().Bool("insecure", false, "Don't verify the server certificate when probing an HTTPS --url")
+	healthcheckCmd.Flags().String("socket", "", "Probe a server listening on this Unix socket")
 
 	// List entries command
 	var listEntriesCmd = &cobra.Command{
@@ -321,6 +770,34 @@ PowerShell:
 	// Add commands to root
 	rootCmd.AddCommand(createFeedCmd)
 	rootCmd.AddCommand(createEntryCmd)
+	rootCmd.AddCommand(importEntriesCmd)
+	rootCmd.AddCommand(importFeedCmd)
+	rootCmd.AddCommand(createRemoteFeedCmd)
+	rootCmd.AddCommand(refreshRemoteFeedCmd)
+	rootCmd.AddCommand(createCompositeFeedCmd)
+	rootCmd.AddCommand(addRuleCmd)
+	rootCmd.AddCommand(listRulesCmd)
+	rootCmd.AddCommand(deleteRuleCmd)
+	rootCmd.AddCommand(testRulesCmd)
+	rootCmd.AddCommand(addWebhookCmd)
+	rootCmd.AddCommand(listWebhooksCmd)
+	rootCmd.AddCommand(deleteWebhookCmd)
+	rootCmd.AddCommand(webhookLogCmd)
+	rootCmd.AddCommand(configureWebSubCmd)
+	rootCmd.AddCommand(setPublicURLCmd)
+	rootCmd.AddCommand(setPrivateCmd)
+	rootCmd.AddCommand(createSubscriberCmd)
+	rootCmd.AddCommand(revokeSubscriberCmd)
+	rootCmd.AddCommand(listSubscribersCmd)
+	rootCmd.AddCommand(subscriberLogCmd)
+	rootCmd.AddCommand(addFeedUserCmd)
+	rootCmd.AddCommand(removeFeedUserCmd)
+	rootCmd.AddCommand(addAdminUserCmd)
+	rootCmd.AddCommand(removeAdminUserCmd)
+	rootCmd.AddCommand(allowNetworkCmd)
+	rootCmd.AddCommand(removeNetworkCmd)
+	rootCmd.AddCommand(showAccessCmd)
+	rootCmd.AddCommand(signEnclosuresCmd)
 	rootCmd.AddCommand(listFeedsCmd)
 	rootCmd.AddCommand(listEntriesCmd)
 	rootCmd.AddCommand(deleteFeedCmd)
@@ -328,12 +805,19 @@ PowerShell:
 	rootCmd.AddCommand(createPodcastCmd)
 	rootCmd.AddCommand(refreshPodcastCmd)
 	rootCmd.AddCommand(listPodcastsCmd)
+	rootCmd.AddCommand(statsCmd)
 	rootCmd.AddCommand(deletePodcastCmd)
 	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(healthcheckCmd)
 	rootCmd.AddCommand(completionCmd)
 
 	// Execute
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+
+	// Let webhook deliveries triggered by the command finish, or queue them for the server
+	finishWebhooks()
+
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
@@ -348,7 +832,7 @@ func getConfigDir() string {
 	// Otherwise use home directory
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		log.Fatalf("Failed to get home directory: %v", err)
+		fatal("Failed to get home directory", "error", err)
 	}
 	return filepath.Join(homeDir, ".chopchoprss")
 }
@@ -364,24 +848,81 @@ func loadConfig() {
 		return
 	}
 
+	loaded, err := readConfig()
+	if err != nil {
+		fatal("Failed to load config file", "path", cfgFile, "error", err)
+	}
+	config = loaded
+}
+
+// readConfig reads the configuration file from disk without touching the global config
+func readConfig() (Config, error) {
+	loaded := Config{
+		Feeds:    make(map[string]Feed),
+		Podcasts: make(map[string]Podcast),
+	}
+
 	data, err := os.ReadFile(cfgFile)
 	if err != nil {
-		log.Fatalf("Failed to read config file: %v", err)
+		return loaded, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return loaded, fmt.Errorf("failed to parse config file: %v", err)
+	}
+
+	if loaded.Feeds == nil {
+		loaded.Feeds = make(map[string]Feed)
+	}
+	if loaded.Podcasts == nil {
+		loaded.Podcasts = make(map[string]Podcast)
 	}
+	for _, feed := range loaded.Feeds {
+		compileRules(feed.Rules)
+	}
+
+	return loaded, nil
+}
 
-	if err := json.Unmarshal(data, &config); err != nil {
-		log.Fatalf("Failed to parse config file: %v", err)
+// updateConfig re-reads the config file, applies fn and saves the result. Long-running
+// processes use it so they don't overwrite changes made by other commands in the meantime.
+func updateConfig(fn func()) {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	reloadConfig()
+	fn()
+	saveConfig()
+}
+
+// reloadConfig replaces the in-memory config with the one on disk, keeping the in-memory
+// one when the file can't be read. Callers must hold configMu for writing.
+func reloadConfig() {
+	configReloads.Inc()
+	if loaded, err := readConfig(); err != nil {
+		configReloadFailures.Inc()
+		slog.Warn("Using in-memory configuration", "error", err)
+	} else {
+		config = loaded
 	}
 }
 
 func saveConfig() {
 	data, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
-		log.Fatalf("Failed to marshal config: %v", err)
+		fatal("Failed to marshal config", "error", err)
 	}
 
-	if err := os.WriteFile(cfgFile, data, 0644); err != nil {
-		log.Fatalf("Failed to write config file: %v", err)
+	// Write to a temporary file first so an interrupted write never leaves a truncated config.
+	// The config holds secrets, tokens and password hashes, so only its owner may read it.
+	// A temporary file left by a crash is removed, since WriteFile keeps an existing mode.
+	tmpFile := cfgFile + ".tmp"
+	os.Remove(tmpFile)
+	if err := os.WriteFile(tmpFile, data, 0600); err != nil {
+		fatal("Failed to write config file", "path", tmpFile, "error", err)
+	}
+	if err := os.Rename(tmpFile, cfgFile); err != nil {
+		fatal("Failed to write config file", "path", cfgFile, "error", err)
 	}
 }
 
@@ -397,37 +938,49 @@ func autoSetupPodcasts(configDir string) {
 	// Read startup configuration
 	data, err := os.ReadFile(startupConfigPath)
 	if err != nil {
-		log.Printf("Warning: Failed to read startup config: %v", err)
+		slog.Warn("Failed to read startup config", "error", err)
 		return
 	}
 
 	var startupConfig StartupConfig
 	if err := json.Unmarshal(data, &startupConfig); err != nil {
-		log.Printf("Warning: Failed to parse startup config: %v", err)
+		slog.Warn("Failed to parse startup config", "error", err)
 		return
 	}
 
 	// Process each podcast in startup config
 	for _, podcastConfig := range startupConfig.Podcasts {
-		// Skip if podcast already exists
-		if _, exists := config.Podcasts[podcastConfig.Name]; exists {
-			log.Printf("Podcast '%s' already exists, skipping auto-setup", podcastConfig.Name)
+		// Skip if podcast already exists, but keep its access policy in sync
+		if podcast, exists := config.Podcasts[podcastConfig.Name]; exists {
+			slog.Debug("Podcast already exists, skipping auto-setup", "podcast", podcastConfig.Name)
+			policy, err := startupAccessPolicy(podcastConfig, podcast.Access)
+			if err != nil {
+				slog.Warn("Invalid access policy", "podcast", podcastConfig.Name, "error", err)
+				continue
+			}
+			podcast.Access = policy
+			config.Podcasts[podcastConfig.Name] = podcast
+			continue
+		}
+
+		policy, err := startupAccessPolicy(podcastConfig, nil)
+		if err != nil {
+			slog.Warn("Invalid access policy, skipping podcast", "podcast", podcastConfig.Name, "error", err)
 			continue
 		}
 
 		// Verify audio directory exists
 		if _, err := os.Stat(podcastConfig.AudioDir); os.IsNotExist(err) {
-			log.Printf("Warning: Audio directory '%s' for podcast '%s' does not exist, skipping", 
-				podcastConfig.AudioDir, podcastConfig.Name)
+			slog.Warn("Audio directory does not exist, skipping podcast",
+				"podcast", podcastConfig.Name, "dir", podcastConfig.AudioDir)
 			continue
 		}
 
 		// Scan audio files
-		log.Printf("Auto-setting up podcast '%s' from %s...", podcastConfig.Name, podcastConfig.AudioDir)
-		episodes, err := scanAudioFiles(podcastConfig.AudioDir, podcastConfig.BaseURL)
+		slog.Info("Auto-setting up podcast", "podcast", podcastConfig.Name, "dir", podcastConfig.AudioDir)
+		episodes, err := scanPodcast(podcastConfig.Name, podcastConfig.AudioDir, podcastConfig.BaseURL)
 		if err != nil {
-			log.Printf("Warning: Failed to scan audio files for podcast '%s': %v", 
-				podcastConfig.Name, err)
+			slog.Warn("Failed to scan audio files", "podcast", podcastConfig.Name, "error", err)
 			continue
 		}
 
@@ -449,15 +1002,17 @@ func autoSetupPodcasts(configDir string) {
 			Created:     now,
 			Updated:     now,
 			Episodes:    episodes,
+			Access:      policy,
+			LastScan:    now,
 		}
 
-		log.Printf("Auto-created podcast '%s' with %d episodes", podcastConfig.Name, len(episodes))
+		slog.Info("Auto-created podcast", "podcast", podcastConfig.Name, "episodes", len(episodes))
 	}
 
 	// Save updated configuration
 	if len(startupConfig.Podcasts) > 0 {
 		saveConfig()
-		log.Printf("Completed auto-setup of podcasts from startup configuration")
+		slog.Debug("Completed auto-setup of podcasts from startup configuration")
 	}
 }
 
@@ -469,27 +1024,70 @@ func createFeed(cmd *cobra.Command, args []string) {
 	author, _ := cmd.Flags().GetString("author")
 	email, _ := cmd.Flags().GetString("email")
 
-	if _, exists := config.Feeds[name]; exists {
-		fmt.Printf("Feed '%s' already exists\n", name)
-		return
-	}
-
-	now := time.Now()
-	config.Feeds[name] = Feed{
+	err := addFeed(name, Feed{
 		Title:       title,
 		Description: description,
 		Link:        link,
 		Author:      author,
 		Email:       email,
-		Created:     now,
-		Updated:     now,
-		Items:       []Item{},
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
 
 	saveConfig()
+	emitFeedEvent(eventFeedCreated, name, "feed")
 	fmt.Printf("Feed '%s' created successfully\n", name)
 }
 
+// Paths serve uses for itself, which feeds can't be named after
+var reservedFeedNames = []string{"admin", "api", "theme", "metrics", "healthz", "readyz", "websub", "podcast-images", "favicon.ico", "chopchop.png"}
+
+// addFeed adds a feed to the config. Commands and the admin UI share it.
+func addFeed(name string, feed Feed) error {
+	if err := validFeedName(name); err != nil {
+		return err
+	}
+	if _, exists := config.Feeds[name]; exists {
+		return fmt.Errorf("Feed '%s' already exists", name)
+	}
+
+	now := time.Now()
+	feed.Created, feed.Updated = now, now
+	feed.Items = []Item{}
+	config.Feeds[name] = feed
+	return nil
+}
+
+// validFeedName checks that a feed name can be served as a path of its own
+func validFeedName(name string) error {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, "/?#%\\ ") {
+		return fmt.Errorf("Invalid feed name '%s', use letters, digits, '-' and '_'", name)
+	}
+	if slices.Contains(reservedFeedNames, strings.ToLower(name)) {
+		return fmt.Errorf("Feed name '%s' is reserved", name)
+	}
+	return nil
+}
+
+// setFeedDetails updates the title, description, link and author of a feed
+func setFeedDetails(name string, details Feed) error {
+	feed, exists := config.Feeds[name]
+	if !exists {
+		return fmt.Errorf("Feed '%s' does not exist", name)
+	}
+
+	feed.Title = details.Title
+	feed.Description = details.Description
+	feed.Link = details.Link
+	feed.Author = details.Author
+	feed.Email = details.Email
+	feed.Updated = time.Now()
+	config.Feeds[name] = feed
+	return nil
+}
+
 func createEntry(cmd *cobra.Command, args []string) {
 	feedName, _ := cmd.Flags().GetString("feed")
 	title, _ := cmd.Flags().GetString("title")
@@ -497,29 +1095,61 @@ func createEntry(cmd *cobra.Command, args []string) {
 	link, _ := cmd.Flags().GetString("link")
 	image, _ := cmd.Flags().GetString("image")
 
-	feed, exists := config.Feeds[feedName]
-	if !exists {
-		fmt.Printf("Feed '%s' does not exist\n", feedName)
-		return
-	}
-
-	now := time.Now()
-	newItem := Item{
+	newItem, err := addEntry(feedName, Item{
 		Title:       title,
 		Description: content,
 		Content:     content,
 		Link:        link,
-		Created:     now,
-		Updated:     now,
 		ImageURL:    image,
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	saveConfig()
+	emitItemEvents(feedName, []Item{newItem}, nil)
+	fmt.Printf("Entry '%s' added to feed '%s'\n", title, feedName)
+}
+
+// addEntry appends an entry to a feed and returns it as stored
+func addEntry(feedName string, item Item) (Item, error) {
+	feed, exists := config.Feeds[feedName]
+	if !exists {
+		return item, fmt.Errorf("Feed '%s' does not exist", feedName)
+	}
+	if feed.Composite != nil {
+		return item, fmt.Errorf("Feed '%s' is a composite feed, add entries to its member feeds instead", feedName)
 	}
 
-	feed.Items = append(feed.Items, newItem)
+	now := time.Now()
+	item.Created, item.Updated = now, now
+	feed.Items = append(feed.Items, item)
 	feed.Updated = now
 	config.Feeds[feedName] = feed
+	return item, nil
+}
 
-	saveConfig()
-	fmt.Printf("Entry '%s' added to feed '%s'\n", title, feedName)
+// updateEntry replaces the entry at an index of a feed, keeping its creation time and GUID
+func updateEntry(feedName string, index int, item Item) (Item, error) {
+	feed, exists := config.Feeds[feedName]
+	if !exists {
+		return item, fmt.Errorf("Feed '%s' does not exist", feedName)
+	}
+	if feed.Composite != nil {
+		return item, fmt.Errorf("Feed '%s' is a composite feed, edit entries in its member feeds instead", feedName)
+	}
+	if index < 0 || index >= len(feed.Items) {
+		return item, fmt.Errorf("Invalid entry index: %d. Valid range: 0-%d", index, len(feed.Items)-1)
+	}
+
+	previous := feed.Items[index]
+	item.Created, item.Updated = previous.Created, time.Now()
+	item.GUID, item.Source, item.SourceTitle, item.Categories = previous.GUID, previous.Source, previous.SourceTitle, previous.Categories
+	feed.Items[index] = item
+	feed.Updated = item.Updated
+	config.Feeds[feedName] = feed
+	return item, nil
 }
 
 func listFeeds(cmd *cobra.Command, args []string) {
@@ -531,6 +1161,22 @@ func listFeeds(cmd *cobra.Command, args []string) {
 	fmt.Println("Available feeds:")
 	for name, feed := range config.Feeds {
 		itemCount := len(feed.Items)
+		if feed.Remote != nil {
+			fmt.Printf("- %s: %s (%d items, mirrors %s)\n", name, feed.Title, itemCount, feed.Remote.URL)
+			continue
+		}
+		if feed.Composite != nil {
+			var members []string
+			for _, member := range feed.Composite.Members {
+				members = append(members, member.Feed)
+			}
+			fmt.Printf("- %s: %s (%d items, composite of %s)\n", name, feed.Title, len(feedItems(feed)), strings.Join(members, ", "))
+			continue
+		}
+		if feed.Private {
+			fmt.Printf("- %s: %s (%d items, private, %d subscribers)\n", name, feed.Title, itemCount, len(feed.Subscribers))
+			continue
+		}
 		fmt.Printf("- %s: %s (%d items)\n", name, feed.Title, itemCount)
 	}
 }
@@ -544,13 +1190,14 @@ func listEntries(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	if len(feed.Items) == 0 {
+	items := feedItems(feed)
+	if len(items) == 0 {
 		fmt.Printf("No entries in feed '%s'\n", feedName)
 		return
 	}
 
 	fmt.Printf("Entries in feed '%s':\n", feedName)
-	for i, item := range feed.Items {
+	for i, item := range items {
 		created := item.Created.Format("2006-01-02 15:04:05")
 		hasImage := "no"
 		if item.ImageURL != "" {
@@ -563,38 +1210,60 @@ func listEntries(cmd *cobra.Command, args []string) {
 func deleteFeed(cmd *cobra.Command, args []string) {
 	name, _ := cmd.Flags().GetString("name")
 
-	if _, exists := config.Feeds[name]; !exists {
-		fmt.Printf("Feed '%s' does not exist\n", name)
+	if err := removeFeed(name); err != nil {
+		fmt.Println(err)
 		return
 	}
 
-	delete(config.Feeds, name)
 	saveConfig()
+	emitFeedEvent(eventFeedDeleted, name, "feed")
 	fmt.Printf("Feed '%s' deleted successfully\n", name)
 }
 
+// removeFeed deletes a feed from the config
+func removeFeed(name string) error {
+	if _, exists := config.Feeds[name]; !exists {
+		return fmt.Errorf("Feed '%s' does not exist", name)
+	}
+	delete(config.Feeds, name)
+	return nil
+}
+
 func deleteEntry(cmd *cobra.Command, args []string) {
 	feedName, _ := cmd.Flags().GetString("feed")
 	index, _ := cmd.Flags().GetInt("index")
 
+	deleted, err := removeEntry(feedName, index)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	saveConfig()
+	emitEvent(WebhookPayload{Event: eventEntryDeleted, Feed: feedName, Entry: &deleted})
+	fmt.Printf("Entry at index %d deleted from feed '%s'\n", index, feedName)
+}
+
+// removeEntry deletes the entry at an index of a feed and returns it
+func removeEntry(feedName string, index int) (Item, error) {
 	feed, exists := config.Feeds[feedName]
 	if !exists {
-		fmt.Printf("Feed '%s' does not exist\n", feedName)
-		return
+		return Item{}, fmt.Errorf("Feed '%s' does not exist", feedName)
+	}
+	if feed.Composite != nil {
+		return Item{}, fmt.Errorf("Feed '%s' is a composite feed, delete entries from its member feeds instead", feedName)
 	}
 
 	if index < 0 || index >= len(feed.Items) {
-		fmt.Printf("Invalid entry index: %d. Valid range: 0-%d\n", index, len(feed.Items)-1)
-		return
+		return Item{}, fmt.Errorf("Invalid entry index: %d. Valid range: 0-%d", index, len(feed.Items)-1)
 	}
 
 	// Remove the entry at the specified index
+	deleted := feed.Items[index]
 	feed.Items = append(feed.Items[:index], feed.Items[index+1:]...)
 	feed.Updated = time.Now()
 	config.Feeds[feedName] = feed
-
-	saveConfig()
-	fmt.Printf("Entry at index %d deleted from feed '%s'\n", index, feedName)
+	return deleted, nil
 }
 
 // Audio file extensions supported
@@ -615,81 +1284,21 @@ func scanAudioFiles(audioDir, baseURL string) ([]Episode, error) {
 			return err
 		}
 
-		if info.IsDir() {
-			return nil
-		}
-
-		ext := strings.ToLower(filepath.Ext(path))
-		mimeType, supported := supportedAudioExts[ext]
-		if !supported {
+		// Skip hidden files and directories, including generated .artwork
+		if path != audioDir && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
-		// Extract metadata from audio file
-		file, err := os.Open(path)
-		if err != nil {
-			log.Printf("Failed to open audio file %s: %v", path, err)
+		if info.IsDir() {
 			return nil
 		}
-		defer file.Close()
-
-		m, err := tag.ReadFrom(file)
-		if err != nil {
-			log.Printf("Failed to read metadata from %s: %v", path, err)
-			// Continue with basic info even if metadata fails
-		}
-
-		// Get file info
-		relPath, _ := filepath.Rel(audioDir, path)
-		// URL-encode the path to handle special characters like & in filenames
-		encodedPath := url.PathEscape(strings.ReplaceAll(relPath, "\\", "/"))
-		// Manually encode & for XML compatibility
-		encodedPath = strings.ReplaceAll(encodedPath, "&", "%26")
-		audioURL := strings.TrimSuffix(baseURL, "/") + "/audio/" + encodedPath
-
-		// Create episode
-		episode := Episode{
-			Title:     html.EscapeString(getStringOrDefault(m, "title", filepath.Base(path))),
-			AudioURL:  audioURL,
-			FilePath:  path,
-			FileSize:  info.Size(),
-			MimeType:  mimeType,
-			Published: info.ModTime(),
-		}
-
-		if m != nil {
-			episode.Description = html.EscapeString(getStringOrDefault(m, "comment", ""))
-			if album := m.Album(); album != "" {
-				episode.Description = html.EscapeString(album + " - " + episode.Description)
-			}
-
-			// Try to extract episode/season numbers
-			if track, total := m.Track(); track != 0 {
-				episode.Episode = track
-				_ = total // Could be used for validation
-			}
-
-			// Try to extract season from album or genre
-			if disc, _ := m.Disc(); disc != 0 {
-				episode.Season = disc
-			}
 
-			// Extract artwork if available
-			if picture := m.Picture(); picture != nil {
-				// Create artwork URL based on the audio file path
-				artworkPath := strings.TrimSuffix(relPath, filepath.Ext(relPath)) + "_artwork.jpg"
-				encodedArtworkPath := url.PathEscape(strings.ReplaceAll(artworkPath, "\\", "/"))
-				// Manually encode & for XML compatibility
-				encodedArtworkPath = strings.ReplaceAll(encodedArtworkPath, "&", "%26")
-				artworkURL := strings.TrimSuffix(baseURL, "/") + "/artwork/" + encodedArtworkPath
-				episode.ImageURL = artworkURL
-				
-				// Save artwork to file system for serving
-				saveEpisodeArtwork(path, picture.Data, artworkPath, audioDir)
-			}
+		if episode, ok := scanAudioFile(audioDir, baseURL, path, info); ok {
+			episodes = append(episodes, episode)
 		}
-
-		episodes = append(episodes, episode)
 		return nil
 	})
 
@@ -705,6 +1314,82 @@ func scanAudioFiles(audioDir, baseURL string) ([]Episode, error) {
 	return episodes, nil
 }
 
+// scanAudioFile reads the metadata of one file in a podcast's audio directory. It returns
+// false for files that aren't supported audio or can't be read.
+func scanAudioFile(audioDir, baseURL, path string, info os.FileInfo) (Episode, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	mimeType, supported := supportedAudioExts[ext]
+	if !supported {
+		return Episode{}, false
+	}
+
+	// Extract metadata from audio file
+	file, err := os.Open(path)
+	if err != nil {
+		slog.Warn("Failed to open audio file", "path", path, "error", err)
+		return Episode{}, false
+	}
+	defer file.Close()
+
+	m, err := tag.ReadFrom(file)
+	if err != nil {
+		slog.Warn("Failed to read audio metadata", "path", path, "error", err)
+		// Continue with basic info even if metadata fails
+	}
+
+	// Get file info
+	relPath, _ := filepath.Rel(audioDir, path)
+	// URL-encode the path to handle special characters like & in filenames
+	encodedPath := url.PathEscape(strings.ReplaceAll(relPath, "\\", "/"))
+	// Manually encode & for XML compatibility
+	encodedPath = strings.ReplaceAll(encodedPath, "&", "%26")
+	audioURL := strings.TrimSuffix(baseURL, "/") + "/audio/" + encodedPath
+
+	// Create episode
+	episode := Episode{
+		Title:     html.EscapeString(getStringOrDefault(m, "title", filepath.Base(path))),
+		AudioURL:  audioURL,
+		FilePath:  path,
+		FileSize:  info.Size(),
+		MimeType:  mimeType,
+		Published: info.ModTime(),
+	}
+
+	if m != nil {
+		episode.Description = html.EscapeString(getStringOrDefault(m, "comment", ""))
+		if album := m.Album(); album != "" {
+			episode.Description = html.EscapeString(album + " - " + episode.Description)
+		}
+
+		// Try to extract episode/season numbers
+		if track, total := m.Track(); track != 0 {
+			episode.Episode = track
+			_ = total // Could be used for validation
+		}
+
+		// Try to extract season from album or genre
+		if disc, _ := m.Disc(); disc != 0 {
+			episode.Season = disc
+		}
+
+		// Extract artwork if available
+		if picture := m.Picture(); picture != nil {
+			// Create artwork URL based on the audio file path
+			artworkPath := strings.TrimSuffix(relPath, filepath.Ext(relPath)) + "_artwork.jpg"
+			encodedArtworkPath := url.PathEscape(strings.ReplaceAll(artworkPath, "\\", "/"))
+			// Manually encode & for XML compatibility
+			encodedArtworkPath = strings.ReplaceAll(encodedArtworkPath, "&", "%26")
+			artworkURL := strings.TrimSuffix(baseURL, "/") + "/artwork/" + encodedArtworkPath
+			episode.ImageURL = artworkURL
+			
+			// Save artwork to file system for serving
+			saveEpisodeArtwork(path, picture.Data, artworkPath, audioDir)
+		}
+	}
+
+	return episode, true
+}
+
 // Helper function to safely get string values from metadata
 func getStringOrDefault(m tag.Metadata, field, defaultValue string) string {
 	if m == nil {
@@ -742,18 +1427,18 @@ func saveEpisodeArtwork(audioFilePath string, artworkData []byte, artworkPath, a
 	// Create artwork directory if it doesn't exist
 	artworkDir := filepath.Join(audioDir, ".artwork")
 	if err := os.MkdirAll(artworkDir, 0755); err != nil {
-		log.Printf("Failed to create artwork directory: %v", err)
+		slog.Warn("Failed to create artwork directory", "error", err)
 		return
 	}
 
 	// Save artwork file
 	artworkFilePath := filepath.Join(artworkDir, filepath.Base(artworkPath))
 	if err := os.WriteFile(artworkFilePath, artworkData, 0644); err != nil {
-		log.Printf("Failed to save artwork for %s: %v", audioFilePath, err)
+		slog.Warn("Failed to save artwork", "path", audioFilePath, "error", err)
 		return
 	}
 
-	log.Printf("Saved artwork for %s", filepath.Base(audioFilePath))
+	slog.Debug("Saved artwork", "path", audioFilePath)
 }
 
 // createPodcast creates a new podcast feed from a directory of audio files
@@ -785,7 +1470,7 @@ func createPodcast(cmd *cobra.Command, args []string) {
 
 	// Scan audio files
 	fmt.Printf("Scanning audio files in %s...\n", audioDir)
-	episodes, err := scanAudioFiles(audioDir, baseURL)
+	episodes, err := scanPodcast(name, audioDir, baseURL)
 	if err != nil {
 		fmt.Printf("Failed to scan audio files: %v\n", err)
 		return
@@ -808,9 +1493,11 @@ func createPodcast(cmd *cobra.Command, args []string) {
 		Created:     now,
 		Updated:     now,
 		Episodes:    episodes,
+		LastScan:    now,
 	}
 
 	saveConfig()
+	emitFeedEvent(eventFeedCreated, name, "podcast")
 	fmt.Printf("Podcast '%s' created with %d episodes\n", name, len(episodes))
 }
 
@@ -826,18 +1513,170 @@ func refreshPodcast(cmd *cobra.Command, args []string) {
 
 	// Rescan audio files
 	fmt.Printf("Rescanning audio files in %s...\n", podcast.AudioDir)
-	episodes, err := scanAudioFiles(podcast.AudioDir, podcast.BaseURL)
+	episodes, err := scanPodcast(name, podcast.AudioDir, podcast.BaseURL)
+	recordScanResult(name, err)
 	if err != nil {
+		saveConfig()
 		fmt.Printf("Failed to scan audio files: %v\n", err)
 		return
 	}
 
+	newEpisodes, err := setPodcastEpisodes(name, episodes)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	saveConfig()
+	if len(newEpisodes) > 0 {
+		emitEvent(WebhookPayload{Event: eventPodcastRefreshed, Feed: name, Episodes: newEpisodes})
+	}
+	fmt.Printf("Podcast '%s' refreshed with %d episodes\n", name, len(config.Podcasts[name].Episodes))
+}
+
+// rescanPodcast rescans the audio of a podcast from inside the server. Files are read
+// without holding the config lock; the episodes are stored in the latest config.
+func rescanPodcast(name string) ([]Episode, error) {
+	configMu.RLock()
+	podcast, exists := config.Podcasts[name]
+	configMu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("Podcast '%s' does not exist", name)
+	}
+	if podcast.AudioDir == "" {
+		return nil, fmt.Errorf("Podcast '%s' has no audio directory to scan", name)
+	}
+
+	episodes, err := scanPodcast(name, podcast.AudioDir, podcast.BaseURL)
+	if err != nil {
+		updateConfig(func() { recordScanResult(name, err) })
+		return nil, err
+	}
+
+	var newEpisodes []Episode
+	updateConfig(func() {
+		recordScanResult(name, nil)
+		newEpisodes, err = setPodcastEpisodes(name, episodes)
+		if err == nil && len(newEpisodes) > 0 {
+			emitEvent(WebhookPayload{Event: eventPodcastRefreshed, Feed: name, Episodes: newEpisodes})
+		}
+	})
+	return newEpisodes, err
+}
+
+// setPodcastEpisodes stores the episodes of a rescan and returns the ones that are new.
+// Files keep the GUID they had, and imported episodes hosted elsewhere are kept.
+func setPodcastEpisodes(name string, episodes []Episode) ([]Episode, error) {
+	podcast, exists := config.Podcasts[name]
+	if !exists {
+		return nil, fmt.Errorf("Podcast '%s' does not exist", name)
+	}
+
+	guids := make(map[string]string)
+	var remote []Episode
+	for _, episode := range podcast.Episodes {
+		if episode.FilePath == "" {
+			remote = append(remote, episode)
+		} else if episode.GUID != "" {
+			guids[episodeFileKey(podcast, episode)] = episode.GUID
+		}
+	}
+
+	// Metadata uploaded with a file wins over its tags, as long as the file is there
+	present := make(map[string]bool)
+	for i := range episodes {
+		key := episodeFileKey(podcast, episodes[i])
+		episodes[i] = applyEpisodeDetails(podcast, episodes[i])
+		if episodes[i].GUID == "" {
+			episodes[i].GUID = guids[key]
+		}
+		present[key] = true
+	}
+	for key := range podcast.EpisodeDetails {
+		if !present[key] {
+			delete(podcast.EpisodeDetails, key)
+		}
+	}
+
+	episodes = append(episodes, remote...)
+	sort.SliceStable(episodes, func(i, j int) bool {
+		return episodes[i].Published.Before(episodes[j].Published)
+	})
+
+	newEpisodes := newPodcastEpisodes(podcast.Episodes, episodes)
 	podcast.Episodes = episodes
 	podcast.Updated = time.Now()
 	config.Podcasts[name] = podcast
+	podcastEpisodes.WithLabelValues(name).Set(float64(len(episodes)))
+	return newEpisodes, nil
+}
 
-	saveConfig()
-	fmt.Printf("Podcast '%s' refreshed with %d episodes\n", name, len(episodes))
+// addPodcastEpisode stores one newly scanned episode, replacing the episode of the same
+// file. Details uploaded with the file are kept for later rescans.
+func addPodcastEpisode(name string, episode Episode, details EpisodeDetails) (Episode, error) {
+	podcast, exists := config.Podcasts[name]
+	if !exists {
+		return episode, fmt.Errorf("Podcast '%s' does not exist", name)
+	}
+
+	if details != (EpisodeDetails{}) {
+		if podcast.EpisodeDetails == nil {
+			podcast.EpisodeDetails = make(map[string]EpisodeDetails)
+		}
+		podcast.EpisodeDetails[episodeFileKey(podcast, episode)] = details
+	}
+	episode = applyEpisodeDetails(podcast, episode)
+
+	episodes := slices.DeleteFunc(slices.Clone(podcast.Episodes), func(e Episode) bool {
+		return filepath.Clean(e.FilePath) == filepath.Clean(episode.FilePath)
+	})
+	episodes = append(episodes, episode)
+	sort.SliceStable(episodes, func(i, j int) bool {
+		return episodes[i].Published.Before(episodes[j].Published)
+	})
+
+	podcast.Episodes = episodes
+	podcast.Updated = time.Now()
+	config.Podcasts[name] = podcast
+	return episode, nil
+}
+
+// setPodcastDetails updates the metadata of a podcast shown in podcast apps
+func setPodcastDetails(name string, details Podcast) error {
+	podcast, exists := config.Podcasts[name]
+	if !exists {
+		return fmt.Errorf("Podcast '%s' does not exist", name)
+	}
+
+	podcast.Title = details.Title
+	podcast.Description = details.Description
+	podcast.Link = details.Link
+	podcast.Author = details.Author
+	podcast.Email = details.Email
+	podcast.ImageURL = details.ImageURL
+	podcast.Categories = details.Categories
+	podcast.Language = details.Language
+	podcast.Copyright = details.Copyright
+	podcast.Explicit = details.Explicit
+	podcast.Updated = time.Now()
+	config.Podcasts[name] = podcast
+	return nil
+}
+
+// newPodcastEpisodes returns the episodes of a rescan that weren't in the podcast before
+func newPodcastEpisodes(previous, current []Episode) []Episode {
+	known := make(map[string]bool, len(previous))
+	for _, episode := range previous {
+		known[episode.AudioURL] = true
+	}
+
+	var added []Episode
+	for _, episode := range current {
+		if !known[episode.AudioURL] {
+			added = append(added, episode)
+		}
+	}
+	return added
 }
 
 // listPodcasts lists all configured podcasts
@@ -850,6 +1689,10 @@ func listPodcasts(cmd *cobra.Command, args []string) {
 	fmt.Println("Available podcasts:")
 	for name, podcast := range config.Podcasts {
 		episodeCount := len(podcast.Episodes)
+		if podcast.Private {
+			fmt.Printf("- %s: %s (%d episodes, private, %d subscribers)\n", name, podcast.Title, episodeCount, len(podcast.Subscribers))
+			continue
+		}
 		fmt.Printf("- %s: %s (%d episodes)\n", name, podcast.Title, episodeCount)
 	}
 }
@@ -858,108 +1701,225 @@ func listPodcasts(cmd *cobra.Command, args []string) {
 func deletePodcast(cmd *cobra.Command, args []string) {
 	name, _ := cmd.Flags().GetString("name")
 
-	if _, exists := config.Podcasts[name]; !exists {
-		fmt.Printf("Podcast '%s' does not exist\n", name)
+	if err := removePodcast(name); err != nil {
+		fmt.Println(err)
 		return
 	}
 
-	delete(config.Podcasts, name)
 	saveConfig()
+	emitFeedEvent(eventFeedDeleted, name, "podcast")
 	fmt.Printf("Podcast '%s' deleted successfully\n", name)
 }
 
+// removePodcast deletes a podcast from the config
+func removePodcast(name string) error {
+	if _, exists := config.Podcasts[name]; !exists {
+		return fmt.Errorf("Podcast '%s' does not exist", name)
+	}
+	delete(config.Podcasts, name)
+	return nil
+}
+
 func serve(cmd *cobra.Command, args []string) {
-	port, _ := cmd.Flags().GetString("port")
+	metricsListen, _ := cmd.Flags().GetString("metrics-listen")
+	accessLogFormat, _ := cmd.Flags().GetString("access-log-format")
+	accessLogFile, _ := cmd.Flags().GetString("access-log")
+	shutdownTimeout, _ := cmd.Flags().GetDuration("shutdown-timeout")
+	stylesheet, _ := cmd.Flags().GetBool("feed-stylesheet")
+	themeDirFlag, _ := cmd.Flags().GetString("theme-dir")
+
+	accessLog, err := newAccessLogger(accessLogFormat, accessLogFile)
+	if err != nil {
+		fmt.Printf("Error opening access log: %v\n", err)
+		return
+	}
 
-	r := mux.NewRouter()
+	limits, err := newAbuseLimits(cmd)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
 
-	// Handle homepage
-	r.HandleFunc("/", serveHomepage)
-	
-	// Serve the logo
-	r.HandleFunc("/chopchop.png", serveLogo)
+	proxies, _ := cmd.Flags().GetStringSlice("trusted-proxy")
+	if err := parseTrustedProxies(proxies); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
 
-	// Handle regular RSS feeds
-	for name := range config.Feeds {
-		feedName := name // Capture for closure
-		r.HandleFunc("/"+feedName, func(w http.ResponseWriter, r *http.Request) {
-			serveRSSFeed(w, feedName)
-		})
+	theme, err := loadTheme(themeDirFlag)
+	if err != nil {
+		fmt.Printf("Error loading theme: %v\n", err)
+		return
 	}
 
-	// Handle podcast feeds
-	for name, podcast := range config.Podcasts {
-		podcastName := name // Capture for closure
-		// Extract path from baseURL (e.g., "http://localhost:8090/joystiq" -> "/joystiq")
-		urlPath := strings.TrimPrefix(podcast.BaseURL, podcast.BaseURL[:strings.LastIndex(podcast.BaseURL, "/")])
-		if urlPath == "" {
-			urlPath = "/" + podcastName // Fallback to name if can't parse URL
-		}
-		r.HandleFunc(urlPath, func(w http.ResponseWriter, r *http.Request) {
-			servePodcastFeed(w, podcastName)
-		})
+	listeners, httpsPort, err := serveListeners(cmd)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
 	}
 
-	// Serve audio files
-	for name, podcast := range config.Podcasts {
-		podcastName := name // Capture for closure
-		audioDir := podcast.AudioDir
-		// Extract path from baseURL for consistency
-		urlPath := strings.TrimPrefix(podcast.BaseURL, podcast.BaseURL[:strings.LastIndex(podcast.BaseURL, "/")])
-		if urlPath == "" {
-			urlPath = "/" + podcastName // Fallback to name if can't parse URL
-		}
-		audioPath := urlPath + "/audio/"
-		r.PathPrefix(audioPath).Handler(
-			http.StripPrefix(audioPath, http.FileServer(http.Dir(audioDir))),
-		)
+	tlsConfig, challengeServer, err := serverTLS(cmd, httpsPort)
+	if err != nil {
+		closeListeners(listeners)
+		fmt.Printf("Error setting up TLS: %v\n", err)
+		return
+	}
 
-		// Serve artwork files
-		artworkPath := urlPath + "/artwork/"
-		artworkDir := filepath.Join(audioDir, ".artwork")
-		r.PathPrefix(artworkPath).Handler(
-			http.StripPrefix(artworkPath, http.FileServer(http.Dir(artworkDir))),
-		)
+	r := mux.NewRouter()
+	r.Use(metricsMiddleware)
+
+	// Handle homepage and its theme
+	r.Handle("/", theme.homepageHandler())
+	r.PathPrefix(themeAssetPath).Handler(theme.assetHandler())
+	r.Handle("/favicon.ico", theme.assetRoute(themeFavicon))
+	r.Handle("/chopchop.png", theme.assetRoute(themeLogo)) // Logo URL of older releases
+
+	// Style feeds opened in a browser
+	if stylesheet {
+		feedStylesheetURL = theme.assetURL(themeFeedXSL)
 	}
 
+	// Feeds, podcasts and their media, matched when no other route does
+	routes := newFeedRoutes(limits, theme)
+	r.NotFoundHandler = routes
+
+	// Web admin, for users added with add-admin-user
+	admin, err := newAdminUI(routes)
+	if err != nil {
+		closeListeners(listeners)
+		fmt.Printf("Error loading admin UI: %v\n", err)
+		return
+	}
+	admin.register(r)
+	registerUploadRoutes(r, limits)
+
 	// Serve podcast images from /podcast-images directory
 	podcastImagesDir := "/podcast-images"
 	if _, err := os.Stat(podcastImagesDir); err == nil {
 		r.PathPrefix("/podcast-images/").Handler(
 			http.StripPrefix("/podcast-images/", http.FileServer(http.Dir(podcastImagesDir))),
 		)
-		log.Printf("Serving podcast images from %s at /podcast-images/", podcastImagesDir)
+		slog.Info("Serving podcast images at /podcast-images/", "dir", podcastImagesDir)
 	}
 
-	fmt.Printf("Starting server on http://localhost:%s\n", port)
+	// Download statistics
+	r.HandleFunc("/api/stats", serveStatsAPI)
+	r.HandleFunc("/healthz", serveHealthz)
+	r.HandleFunc("/readyz", serveReadyz)
 
-	if len(config.Feeds) > 0 {
-		fmt.Println("Available RSS feeds:")
-		for name := range config.Feeds {
-			fmt.Printf("- http://localhost:%s/%s\n", port, name)
-		}
+	// Prometheus metrics
+	if err := serveMetrics(cmd, r, metricsListen); err != nil {
+		fatal("Failed to start metrics server", "error", err)
+	}
+	setEpisodeGauges()
+
+	// Act as a WebSub hub if configured
+	if config.WebSub != nil && config.WebSub.Builtin {
+		r.HandleFunc("/websub", handleWebSubHub)
+	}
+
+	// Stop on SIGINT or SIGTERM, e.g. from docker stop
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Keep mirrored feeds up to date in the background
+	startRemotePolling(ctx)
+
+	// Deliver webhook events that commands and earlier runs couldn't
+	go retryQueuedWebhooks(ctx)
+
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
 	}
 
-	if len(config.Podcasts) > 0 {
-		fmt.Println("Available podcast feeds:")
-		for name := range config.Podcasts {
-			fmt.Printf("- http://localhost:%s/%s\n", port, name)
+	server := newHTTPServer(cmd, accessLog.middleware(r))
+	server.TLSConfig = tlsConfig
+	var bindings []binding
+	for _, listener := range listeners {
+		slog.Info("Starting server", "url", listenerURL(listener, scheme))
+		bindings = append(bindings, binding{server, listener})
+	}
+	if challengeServer != nil {
+		listener, err := listen(cmd, challengeServer.Addr)
+		if err != nil {
+			fatal("Failed to start ACME challenge server", "error", err)
 		}
+		slog.Info("Answering ACME challenges and redirecting to HTTPS", "url", listenerURL(listener, "http"))
+		bindings = append(bindings, binding{challengeServer, listener})
+	}
+
+	for name, feed := range config.Feeds {
+		slog.Info("Serving RSS feed", "path", "/"+name, "private", restrictedFeed(feed))
+	}
+
+	for name, podcast := range config.Podcasts {
+		slog.Info("Serving podcast feed", "path", podcastURLPath(name, podcast), "private", restrictedPodcast(podcast))
 	}
 
 	if len(config.Feeds) == 0 && len(config.Podcasts) == 0 {
-		fmt.Println("No feeds or podcasts configured")
+		slog.Warn("No feeds or podcasts configured")
+	}
+
+	deadline, err := runServers(ctx, shutdownTimeout, bindings...)
+	if err != nil {
+		fatal("Server failed", "error", err)
 	}
+	flushState(deadline, accessLog)
+	slog.Info("Server stopped")
+}
 
-	log.Fatal(http.ListenAndServe(":"+port, r))
+// podcastURLPath returns the route a podcast is served under, taken from the last
+// segment of its base URL (e.g., "http://localhost:8090/joystiq" -> "/joystiq")
+func podcastURLPath(podcastName string, podcast Podcast) string {
+	urlPath := strings.TrimPrefix(podcast.BaseURL, podcast.BaseURL[:strings.LastIndex(podcast.BaseURL, "/")])
+	if urlPath == "" {
+		urlPath = "/" + podcastName // Fallback to name if can't parse URL
+	}
+	return urlPath
 }
 
-func serveRSSFeed(w http.ResponseWriter, feedName string) {
-	feed, exists := config.Feeds[feedName]
-	if !exists {
+func serveRSSFeed(w http.ResponseWriter, r *http.Request, feedName string) {
+	if _, ok := authorizeSubscriber(w, r, feedName); !ok {
+		return
+	}
+
+	rss, err := renderRSSFeed(feedName)
+	if err == errFeedNotFound {
 		http.NotFound(w, nil)
 		return
 	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	configMu.RLock()
+	hub, topic := websubHubURL(), feedTopicURL(feedName)
+	configMu.RUnlock()
+
+	setWebSubHeaders(w, hub, topic)
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(addStylesheet(rss, feedStylesheetURL)))
+}
+
+// renderRSSFeed renders a feed as an RSS document
+func renderRSSFeed(feedName string) (string, error) {
+	defer observeRender(feedName, "feed", time.Now())
+
+	configMu.RLock()
+	feed, exists := config.Feeds[feedName]
+	items := renderedItems(feed)
+	hub, topic := websubHubURL(), feedTopicURL(feedName)
+	configMu.RUnlock()
+	if !exists {
+		return "", errFeedNotFound
+	}
+
+	// A composite changes whenever one of its members does
+	if feed.Composite != nil {
+		feed.Updated = latestItemTime(feed.Updated, items)
+	}
 
 	// Convert our feed structure to gorilla/feeds format
 	// now := time.Now()
@@ -972,13 +1932,14 @@ func serveRSSFeed(w http.ResponseWriter, feedName string) {
 		Updated:     feed.Updated,
 	}
 
-	f.Items = make([]*feeds.Item, len(feed.Items))
-	for i, item := range feed.Items {
+	f.Items = make([]*feeds.Item, len(items))
+	for i, item := range items {
 		feedItem := &feeds.Item{
 			Title:       item.Title,
 			Link:        &feeds.Link{Href: item.Link},
 			Description: item.Description,
 			Content:     item.Content,
+			Id:          item.GUID,
 			Created:     item.Created,
 			Updated:     item.Updated,
 		}
@@ -994,22 +1955,98 @@ func serveRSSFeed(w http.ResponseWriter, feedName string) {
 		f.Items[i] = feedItem
 	}
 
-	rss, err := f.ToRss()
+	channel := &renderedRSSChannel{RssFeed: (&feeds.Rss{Feed: f}).RssFeed()}
+	for i, rssItem := range channel.RssFeed.Items {
+		item := &renderedRSSItem{RssItem: rssItem}
+		if items[i].Source != "" {
+			item.Source = &rssSource{URL: items[i].Source, Title: items[i].SourceTitle}
+		}
+		channel.Items = append(channel.Items, item)
+	}
+
+	rss, err := feeds.ToXML(channel)
+	if err != nil {
+		return "", err
+	}
+
+	return addWebSubLinks(rss, hub, topic), nil
+}
+
+// rssSource is the <source> element of an RSS item, naming the feed the item came from
+type rssSource struct {
+	URL   string `xml:"url,attr"`
+	Title string `xml:",chardata"`
+}
+
+// renderedRSSItem is a gorilla/feeds RSS item with a <source> element that has its url attribute
+type renderedRSSItem struct {
+	*feeds.RssItem
+	Source *rssSource `xml:"source,omitempty"`
+}
+
+// renderedRSSChannel is a gorilla/feeds RSS channel holding renderedRSSItems
+type renderedRSSChannel struct {
+	*feeds.RssFeed
+	Items []*renderedRSSItem `xml:"item"`
+}
+
+// FeedXml wraps the channel in an <rss> element, like gorilla/feeds does
+func (c *renderedRSSChannel) FeedXml() interface{} {
+	return &struct {
+		XMLName          xml.Name `xml:"rss"`
+		Version          string   `xml:"version,attr"`
+		ContentNamespace string   `xml:"xmlns:content,attr"`
+		Channel          *renderedRSSChannel
+	}{Version: "2.0", ContentNamespace: "http://purl.org/rss/1.0/modules/content/", Channel: c}
+}
+
+// servePodcastFeed serves a podcast feed as RSS with podcast-specific elements
+func servePodcastFeed(w http.ResponseWriter, r *http.Request, podcastName string) {
+	subscriber, ok := authorizeSubscriber(w, r, podcastName)
+	if !ok {
+		return
+	}
+
+	// Media URLs are signed for each request, for the subscriber reading a private
+	// podcast and with a fresh expiry when signed URLs are enabled
+	configMu.RLock()
+	signURL := podcastMediaSigner(config.Podcasts[podcastName], subscriber)
+	configMu.RUnlock()
+
+	rss, err := renderPodcastFeed(podcastName, signURL)
+	if err == errFeedNotFound {
+		http.NotFound(w, nil)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	configMu.RLock()
+	hub, topic := websubHubURL(), podcastTopicURL(podcastName)
+	configMu.RUnlock()
+
+	setWebSubHeaders(w, hub, topic)
 	w.Header().Set("Content-Type", "application/xml")
-	w.Write([]byte(rss))
+	w.Write([]byte(addStylesheet(rss, feedStylesheetURL)))
 }
 
-// servePodcastFeed serves a podcast feed as RSS with podcast-specific elements
-func servePodcastFeed(w http.ResponseWriter, podcastName string) {
+// renderPodcastFeed renders a podcast as an RSS document with iTunes extensions.
+// When signURL is set it is applied to the podcast's artwork and enclosure URLs.
+func renderPodcastFeed(podcastName string, signURL func(string) string) (string, error) {
+	defer observeRender(podcastName, "podcast", time.Now())
+
+	configMu.RLock()
 	podcast, exists := config.Podcasts[podcastName]
+	hub, topic := websubHubURL(), podcastTopicURL(podcastName)
+	configMu.RUnlock()
 	if !exists {
-		http.NotFound(w, nil)
-		return
+		return "", errFeedNotFound
+	}
+
+	if signURL != nil {
+		podcast = signPodcastURLs(podcast, signURL)
 	}
 
 	// Convert our podcast structure to gorilla/feeds format
@@ -1037,8 +2074,8 @@ func servePodcastFeed(w http.ResponseWriter, podcastName string) {
 	for _, episode := range podcast.Episodes {
 		// Skip episodes with missing required data
 		if episode.Title == "" || episode.AudioURL == "" || episode.MimeType == "" {
-			log.Printf("Skipping episode with missing data: title='%s', audioURL='%s', mimeType='%s'", 
-				episode.Title, episode.AudioURL, episode.MimeType)
+			slog.Warn("Skipping episode with missing data", "podcast", podcastName,
+				"title", episode.Title, "audioURL", episode.AudioURL, "mimeType", episode.MimeType)
 			continue
 		}
 
@@ -1046,6 +2083,7 @@ func servePodcastFeed(w http.ResponseWriter, podcastName string) {
 			Title:       episode.Title,
 			Description: episode.Description,
 			Link:        &feeds.Link{Href: episode.AudioURL}, // Use audio URL as link
+			Id:          episode.GUID,
 			Created:     episode.Published,
 			Updated:     episode.Published,
 		}
@@ -1086,8 +2124,7 @@ func servePodcastFeed(w http.ResponseWriter, podcastName string) {
 	// Generate RSS with podcast extensions
 	rss, err := f.ToRss()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return "", err
 	}
 
 	// Add podcast-specific XML namespaces and elements
@@ -1096,8 +2133,7 @@ func servePodcastFeed(w http.ResponseWriter, podcastName string) {
 	// Add episode artwork to RSS items
 	rss = addEpisodeArtwork(rss, podcast.Episodes)
 
-	w.Header().Set("Content-Type", "application/xml")
-	w.Write([]byte(rss))
+	return addWebSubLinks(rss, hub, topic), nil
 }
 
 // addPodcastExtensions adds iTunes and other podcast-specific XML elements
@@ -1174,7 +2210,7 @@ func addEpisodeArtwork(rss string, episodes []Episode) string {
 		if strings.Contains(line, "</item>") && episodeIndex < len(episodes) {
 			if episodes[episodeIndex].ImageURL != "" {
 				// Add iTunes episode image with proper indentation
-				itunesImage := fmt.Sprintf("    <itunes:image href=\"%s\" />", episodes[episodeIndex].ImageURL)
+				itunesImage := fmt.Sprintf("    <itunes:image href=\"%s\" />", html.EscapeString(episodes[episodeIndex].ImageURL))
 				result = append(result[:len(result)-1], itunesImage, line)
 			}
 			episodeIndex++
@@ -1184,256 +2220,3 @@ func addEpisodeArtwork(rss string, episodes []Episode) string {
 	return strings.Join(result, "\n")
 }
 
-// serveHomepage serves a nice HTML homepage with logo and feed information
-func serveHomepage(w http.ResponseWriter, r *http.Request) {
-	// Only serve homepage on exact root path
-	if r.URL.Path != "/" {
-		http.NotFound(w, r)
-		return
-	}
-
-	feedCount := len(config.Feeds)
-	podcastCount := len(config.Podcasts)
-	
-	html := `<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>ChopChopRSS</title>
-    <style>
-        body {
-            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
-            line-height: 1.6;
-            color: #333;
-            max-width: 800px;
-            margin: 0 auto;
-            padding: 20px;
-            background-color: #f8f9fa;
-        }
-        .container {
-            background: white;
-            border-radius: 10px;
-            padding: 40px;
-            box-shadow: 0 2px 10px rgba(0,0,0,0.1);
-        }
-        .header {
-            text-align: center;
-            margin-bottom: 40px;
-        }
-        .logo {
-            max-width: 200px;
-            height: auto;
-            margin-bottom: 20px;
-        }
-        h1 {
-            color: #2c3e50;
-            margin-bottom: 10px;
-        }
-        .subtitle {
-            color: #7f8c8d;
-            font-size: 1.2em;
-            margin-bottom: 30px;
-        }
-        .stats {
-            display: flex;
-            justify-content: center;
-            gap: 40px;
-            margin: 30px 0;
-            flex-wrap: wrap;
-        }
-        .stat {
-            text-align: center;
-            padding: 20px;
-            background: #ecf0f1;
-            border-radius: 8px;
-            min-width: 120px;
-        }
-        .stat-number {
-            font-size: 2em;
-            font-weight: bold;
-            color: #3498db;
-            display: block;
-        }
-        .stat-label {
-            color: #7f8c8d;
-            text-transform: uppercase;
-            font-size: 0.9em;
-            letter-spacing: 1px;
-        }
-        .feeds-section {
-            margin-top: 40px;
-        }
-        .feeds-grid {
-            display: grid;
-            grid-template-columns: repeat(auto-fit, minmax(300px, 1fr));
-            gap: 30px;
-            margin-top: 20px;
-        }
-        .feed-list {
-            background: #f8f9fa;
-            border-radius: 8px;
-            padding: 20px;
-        }
-        .feed-list h3 {
-            color: #2c3e50;
-            margin-top: 0;
-            margin-bottom: 15px;
-            display: flex;
-            align-items: center;
-            gap: 10px;
-        }
-        .feed-item {
-            margin: 10px 0;
-            padding: 8px 0;
-            border-bottom: 1px solid #ecf0f1;
-        }
-        .feed-item:last-child {
-            border-bottom: none;
-        }
-        .feed-link {
-            color: #3498db;
-            text-decoration: none;
-            font-weight: 500;
-        }
-        .feed-link:hover {
-            text-decoration: underline;
-        }
-        .feed-description {
-            color: #7f8c8d;
-            font-size: 0.9em;
-            margin-top: 5px;
-        }
-        .no-feeds {
-            text-align: center;
-            color: #7f8c8d;
-            font-style: italic;
-            padding: 40px 20px;
-        }
-        .footer {
-            text-align: center;
-            margin-top: 40px;
-            padding-top: 20px;
-            border-top: 1px solid #ecf0f1;
-            color: #7f8c8d;
-            font-size: 0.9em;
-        }
-        .icon {
-            width: 20px;
-            height: 20px;
-            display: inline-block;
-        }
-        @media (max-width: 600px) {
-            .stats {
-                gap: 20px;
-            }
-            .stat {
-                min-width: 100px;
-                padding: 15px;
-            }
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="header">
-            <img src="/chopchop.png" alt="ChopChopRSS Logo" class="logo">
-            <h1>ChopChopRSS</h1>
-            <div class="subtitle">Fast and simple RSS feeds and podcast hosting</div>
-        </div>
-
-        <div class="stats">
-            <div class="stat">
-                <span class="stat-number">` + fmt.Sprintf("%d", feedCount) + `</span>
-                <span class="stat-label">RSS Feeds</span>
-            </div>
-            <div class="stat">
-                <span class="stat-number">` + fmt.Sprintf("%d", podcastCount) + `</span>
-                <span class="stat-label">Podcasts</span>
-            </div>
-        </div>`
-
-	if feedCount > 0 || podcastCount > 0 {
-		html += `
-        <div class="feeds-section">
-            <div class="feeds-grid">`
-		
-		if feedCount > 0 {
-			html += `
-                <div class="feed-list">
-                    <h3>
-                        <span class="icon">📰</span>
-                        RSS Feeds
-                    </h3>`
-			for name, feed := range config.Feeds {
-				itemCount := len(feed.Items)
-				html += fmt.Sprintf(`
-                    <div class="feed-item">
-                        <a href="/%s" class="feed-link">%s</a>
-                        <div class="feed-description">%s • %d items</div>
-                    </div>`, name, feed.Title, feed.Description, itemCount)
-			}
-			html += `
-                </div>`
-		}
-
-		if podcastCount > 0 {
-			html += `
-                <div class="feed-list">
-                    <h3>
-                        <span class="icon">🎧</span>
-                        Podcast Feeds
-                    </h3>`
-			for name, podcast := range config.Podcasts {
-				episodeCount := len(podcast.Episodes)
-				// Extract path from baseURL for consistency
-				urlPath := strings.TrimPrefix(podcast.BaseURL, podcast.BaseURL[:strings.LastIndex(podcast.BaseURL, "/")])
-				if urlPath == "" {
-					urlPath = "/" + name // Fallback to name if can't parse URL
-				}
-				html += fmt.Sprintf(`
-                    <div class="feed-item">
-                        <a href="%s" class="feed-link">%s</a>
-                        <div class="feed-description">%s • %d episodes</div>
-                    </div>`, urlPath, podcast.Title, podcast.Description, episodeCount)
-			}
-			html += `
-                </div>`
-		}
-
-		html += `
-            </div>
-        </div>`
-	} else {
-		html += `
-        <div class="no-feeds">
-            <h3>No feeds or podcasts configured yet</h3>
-            <p>Use the ChopChopRSS CLI to create your first RSS feed or podcast.</p>
-        </div>`
-	}
-
-	html += `
-        <div class="footer">
-            <p>Powered by <strong>ChopChopRSS</strong> • 
-            <a href="https://github.com/madeofpendletonwool/chopchoprss" style="color: #3498db;">GitHub</a></p>
-        </div>
-    </div>
-</body>
-</html>`
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.Write([]byte(html))
-}
-
-// serveLogo serves the chopchop.png logo file
-func serveLogo(w http.ResponseWriter, r *http.Request) {
-	// Try to serve the logo from the current directory
-	logoPath := "chopchop.png"
-	if _, err := os.Stat(logoPath); os.IsNotExist(err) {
-		// If not found, return a simple 404
-		http.NotFound(w, r)
-		return
-	}
-	
-	http.ServeFile(w, r, logoPath)
-}
@@ -0,0 +1,372 @@
+// markdown.go
+package main
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+// Characters a backslash keeps from being read as Markdown
+const markdownEscapable = "\\`*_{}[]()#+-.!<>~|"
+
+// markdownToHTML renders the Markdown entries are written in from the admin UI: headings,
+// paragraphs, emphasis, links, images, code, quotes, lists and rules. Raw HTML is escaped
+// rather than passed through.
+func markdownToHTML(source string) string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\t", "    ")
+	var b strings.Builder
+	renderMarkdownBlocks(&b, strings.Split(source, "\n"), false)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// renderMarkdownBlocks renders a run of lines as block elements. Paragraphs of tight list
+// items are written without <p>.
+func renderMarkdownBlocks(b *strings.Builder, lines []string, tight bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			i++
+
+		case strings.HasPrefix(trimmed, "```"):
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			i++ // Closing fence
+			b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+
+		case markdownHeading(trimmed) > 0:
+			level := markdownHeading(trimmed)
+			text := strings.TrimSpace(strings.TrimRight(trimmed[level:], "#"))
+			tag := "h" + strconv.Itoa(level)
+			b.WriteString("<" + tag + ">" + renderMarkdownInline(text) + "</" + tag + ">\n")
+			i++
+
+		case markdownRule(trimmed):
+			b.WriteString("<hr>\n")
+			i++
+
+		case strings.HasPrefix(trimmed, ">"):
+			var quoted []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				quote := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quoted = append(quoted, strings.TrimPrefix(quote, " "))
+			}
+			b.WriteString("<blockquote>\n")
+			renderMarkdownBlocks(b, quoted, false)
+			b.WriteString("</blockquote>\n")
+
+		case isMarkdownListItem(line):
+			i = renderMarkdownList(b, lines, i)
+
+		default:
+			var paragraph []string
+			for ; i < len(lines) && !markdownBlockStart(lines[i]); i++ {
+				paragraph = append(paragraph, strings.TrimLeft(lines[i], " "))
+			}
+			text := renderMarkdownInline(strings.TrimRight(strings.Join(paragraph, "\n"), " "))
+			if tight {
+				b.WriteString(text + "\n")
+			} else {
+				b.WriteString("<p>" + text + "</p>\n")
+			}
+		}
+	}
+}
+
+// renderMarkdownList renders the list starting at lines[start] and returns the index of
+// the line after it
+func renderMarkdownList(b *strings.Builder, lines []string, start int) int {
+	ordered, first, _ := markdownListItem(lines[start])
+	indent := leadingSpaces(lines[start])
+	contentIndent := len(lines[start]) - len(first)
+
+	var items [][]string
+	loose := false
+	i := start
+	for i < len(lines) {
+		line := lines[i]
+		if o, content, ok := markdownListItem(line); ok && o == ordered && leadingSpaces(line) < contentIndent {
+			items = append(items, []string{content})
+			i++
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			if i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" && leadingSpaces(lines[i+1]) > indent {
+				loose = true
+				items[len(items)-1] = append(items[len(items)-1], "")
+				i++
+				continue
+			}
+			if i+1 < len(lines) {
+				if o, _, ok := markdownListItem(lines[i+1]); ok && o == ordered && leadingSpaces(lines[i+1]) == indent {
+					loose = true
+					i++
+					continue
+				}
+			}
+			break
+		}
+		if spaces := leadingSpaces(line); spaces > indent {
+			items[len(items)-1] = append(items[len(items)-1], line[min(spaces, contentIndent):])
+		} else if !markdownBlockStart(line) {
+			items[len(items)-1] = append(items[len(items)-1], strings.TrimSpace(line)) // Lazy continuation
+		} else {
+			break
+		}
+		i++
+	}
+
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	b.WriteString("<" + tag + ">\n")
+	for _, item := range items {
+		b.WriteString("<li>")
+		var inner strings.Builder
+		renderMarkdownBlocks(&inner, item, !loose)
+		b.WriteString(strings.TrimSuffix(inner.String(), "\n"))
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// markdownBlockStart reports whether a line ends a paragraph by starting another block
+func markdownBlockStart(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, ">") ||
+		markdownHeading(trimmed) > 0 || markdownRule(trimmed) || isMarkdownListItem(line)
+}
+
+// markdownHeading returns the level of an ATX heading like "## Title", 0 when it isn't one
+func markdownHeading(line string) int {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || (level < len(line) && line[level] != ' ') {
+		return 0
+	}
+	return level
+}
+
+// markdownRule reports whether a line is a horizontal rule like --- or * * *
+func markdownRule(line string) bool {
+	compact := strings.ReplaceAll(line, " ", "")
+	if len(compact) < 3 {
+		return false
+	}
+	for _, marker := range []string{"-", "*", "_"} {
+		if strings.Count(compact, marker) == len(compact) {
+			return true
+		}
+	}
+	return false
+}
+
+// markdownListItem parses a list item like "- item" or "1. item"
+func markdownListItem(line string) (ordered bool, content string, ok bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(trimmed) >= 2 && strings.ContainsRune("-*+", rune(trimmed[0])) && trimmed[1] == ' ' {
+		return false, strings.TrimLeft(trimmed[2:], " "), true
+	}
+	digits := 0
+	for digits < len(trimmed) && digits < 9 && trimmed[digits] >= '0' && trimmed[digits] <= '9' {
+		digits++
+	}
+	if digits > 0 && digits+1 < len(trimmed) && (trimmed[digits] == '.' || trimmed[digits] == ')') && trimmed[digits+1] == ' ' {
+		return true, strings.TrimLeft(trimmed[digits+2:], " "), true
+	}
+	return false, "", false
+}
+
+// isMarkdownListItem reports whether a line starts a list item, and isn't a rule
+func isMarkdownListItem(line string) bool {
+	_, _, ok := markdownListItem(line)
+	return ok && !markdownRule(strings.TrimSpace(line))
+}
+
+// leadingSpaces counts the spaces a line is indented by
+func leadingSpaces(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// renderMarkdownInline renders emphasis, code spans, links, images and line breaks
+func renderMarkdownInline(text string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && text[i+1] == '\n':
+			b.WriteString("<br>\n")
+			i += 2
+			continue
+		case c == '\\' && i+1 < len(text) && strings.IndexByte(markdownEscapable, text[i+1]) >= 0:
+			b.WriteString(html.EscapeString(text[i+1 : i+2]))
+			i += 2
+			continue
+
+		case c == ' ':
+			// Two or more spaces at the end of a line break it
+			spaces := len(text[i:]) - len(strings.TrimLeft(text[i:], " "))
+			if i+spaces < len(text) && text[i+spaces] == '\n' {
+				if spaces >= 2 {
+					b.WriteString("<br>")
+				}
+				i += spaces
+				continue
+			}
+
+		case c == '`':
+			ticks := len(text[i:]) - len(strings.TrimLeft(text[i:], "`"))
+			fence := text[i : i+ticks]
+			if end := strings.Index(text[i+ticks:], fence); end >= 0 {
+				code := text[i+ticks : i+ticks+end]
+				if strings.HasPrefix(code, " ") && strings.HasSuffix(code, " ") && strings.TrimSpace(code) != "" {
+					code = code[1 : len(code)-1]
+				}
+				b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i += 2*ticks + end
+				continue
+			}
+			b.WriteString(fence)
+			i += ticks
+			continue
+
+		case c == '!' && strings.HasPrefix(text[i+1:], "["):
+			if alt, dest, title, n, ok := markdownLink(text[i+1:]); ok && safeContentURL(dest) {
+				b.WriteString(`<img src="` + html.EscapeString(dest) + `" alt="` + html.EscapeString(alt) + `"`)
+				if title != "" {
+					b.WriteString(` title="` + html.EscapeString(title) + `"`)
+				}
+				b.WriteString(">")
+				i += 1 + n
+				continue
+			}
+
+		case c == '[':
+			if label, dest, title, n, ok := markdownLink(text[i:]); ok && safeContentURL(dest) {
+				b.WriteString(`<a href="` + html.EscapeString(dest) + `"`)
+				if title != "" {
+					b.WriteString(` title="` + html.EscapeString(title) + `"`)
+				}
+				b.WriteString(">" + renderMarkdownInline(label) + "</a>")
+				i += n
+				continue
+			}
+
+		case c == '<':
+			if end := strings.IndexByte(text[i:], '>'); end > 0 {
+				target := text[i+1 : i+end]
+				lower := strings.ToLower(target)
+				if !strings.ContainsAny(target, " \n<") && (strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "mailto:")) {
+					b.WriteString(`<a href="` + html.EscapeString(target) + `">` + html.EscapeString(strings.TrimPrefix(target, "mailto:")) + "</a>")
+					i += end + 1
+					continue
+				}
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			if rendered, n, ok := markdownEmphasis(text, i); ok {
+				b.WriteString(rendered)
+				i += n
+				continue
+			}
+		}
+
+		b.WriteString(html.EscapeString(text[i : i+1]))
+		i++
+	}
+	return b.String()
+}
+
+// markdownEmphasis renders **strong**, *emphasis* or ~~strikethrough~~ starting at
+// text[start], returning the HTML and the length of source it covers
+func markdownEmphasis(text string, start int) (string, int, bool) {
+	c := text[start]
+	delimiter, tag := string(c), "em"
+	if strings.HasPrefix(text[start:], string(c)+string(c)) {
+		delimiter, tag = string(c)+string(c), "strong"
+	}
+	if c == '~' {
+		if len(delimiter) == 1 {
+			return "", 0, false
+		}
+		tag = "del"
+	}
+
+	// Underscores inside words, like snake_case, aren't emphasis
+	if c == '_' && start > 0 && isWordByte(text[start-1]) {
+		return "", 0, false
+	}
+	open := start + len(delimiter)
+	if open >= len(text) || text[open] == ' ' || text[open] == '\n' {
+		return "", 0, false
+	}
+
+	for search := open + 1; search < len(text); {
+		end := strings.Index(text[search:], delimiter)
+		if end < 0 {
+			return "", 0, false
+		}
+		end += search
+		after := end + len(delimiter)
+		for len(delimiter) == 2 && after < len(text) && text[after] == c {
+			end, after = end+1, after+1 // ***both*** closes the inner emphasis first
+		}
+		if text[end-1] != ' ' && (c != '_' || after >= len(text) || !isWordByte(text[after])) &&
+			(len(delimiter) == 2 || after >= len(text) || text[after] != c) {
+			inner := renderMarkdownInline(text[open:end])
+			return "<" + tag + ">" + inner + "</" + tag + ">", after - start, true
+		}
+		search = end + 1
+	}
+	return "", 0, false
+}
+
+// markdownLink parses [text](url "title") at the start of text, returning its parts and
+// the length of source it covers
+func markdownLink(text string) (label, dest, title string, n int, ok bool) {
+	depth, end := 0, -1
+	for i := 0; i < len(text) && end < 0; i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				end = i
+			}
+		}
+	}
+	if end < 0 || end+1 >= len(text) || text[end+1] != '(' {
+		return "", "", "", 0, false
+	}
+	closing := strings.IndexByte(text[end+2:], ')')
+	if closing < 0 {
+		return "", "", "", 0, false
+	}
+
+	target := strings.TrimSpace(text[end+2 : end+2+closing])
+	dest = target
+	if space := strings.IndexAny(target, " \n"); space >= 0 {
+		dest = target[:space]
+		title = strings.Trim(strings.TrimSpace(target[space:]), `"'`)
+	}
+	dest = strings.TrimSuffix(strings.TrimPrefix(dest, "<"), ">")
+	return text[1:end], dest, title, end + 3 + closing, true
+}
+
+// isWordByte reports whether a byte is part of a word, for underscore emphasis
+func isWordByte(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
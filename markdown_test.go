@@ -0,0 +1,48 @@
+// markdown_test.go
+package main
+
+import "testing"
+
+func TestMarkdownToHTML(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"emphasis", "*em*, **strong**, ***both***, ~~gone~~ and _under_",
+			"<p><em>em</em>, <strong>strong</strong>, <strong><em>both</em></strong>, <del>gone</del> and <em>under</em></p>"},
+		{"underscores inside words", "snake_case_name", "<p>snake_case_name</p>"},
+		{"unmatched delimiters", "2 * 3 and a*b", "<p>2 * 3 and a*b</p>"},
+		{"escaped delimiters", `\*not\* emphasis`, "<p>*not* emphasis</p>"},
+		{"headings", "# Title\n## Sub ##\n#NoSpace", "<h1>Title</h1>\n<h2>Sub</h2>\n<p>#NoSpace</p>"},
+		{"line breaks", "two spaces  \nbackslash\\\nend", "<p>two spaces<br>\nbackslash<br>\nend</p>"},
+		{"tight list", "- one\n- two\n  - nested\n- three",
+			"<ul>\n<li>one</li>\n<li>two\n<ul>\n<li>nested</li>\n</ul></li>\n<li>three</li>\n</ul>"},
+		{"loose list", "- one\n\n- two", "<ul>\n<li><p>one</p></li>\n<li><p>two</p></li>\n</ul>"},
+		{"ordered list", "1. first\n2) second", "<ol>\n<li>first</li>\n<li>second</li>\n</ol>"},
+		{"rule is not a list", "- - -", "<hr>"},
+		{"quote", "> quoted\n> *text*", "<blockquote>\n<p>quoted\n<em>text</em></p>\n</blockquote>"},
+		{"code span", "Use `a <b> *c*` and ``x ` y``", "<p>Use <code>a &lt;b&gt; *c*</code> and <code>x ` y</code></p>"},
+		{"fenced code", "```go\nif a < b && *c {\n}\n```", "<pre><code>if a &lt; b &amp;&amp; *c {\n}</code></pre>"},
+		{"link with title", `[site *here*](https://example.com "The site")`,
+			`<p><a href="https://example.com" title="The site">site <em>here</em></a></p>`},
+		{"image", "![a \"cat\"](/cat.png)", `<p><img src="/cat.png" alt="a &#34;cat&#34;"></p>`},
+		{"autolinks", "<https://example.com/?a=1&b=2> <mailto:me@example.com>",
+			`<p><a href="https://example.com/?a=1&amp;b=2">https://example.com/?a=1&amp;b=2</a> <a href="mailto:me@example.com">me@example.com</a></p>`},
+		{"javascript link", "[x](javascript:alert(1))", "<p>[x](javascript:alert(1))</p>"},
+		{"mixed-case javascript link", "[x](JaVaScRiPt:alert(1))", "<p>[x](JaVaScRiPt:alert(1))</p>"},
+		{"data image", "![x](data:image/png;base64,AAAA)", "<p>![x](data:image/png;base64,AAAA)</p>"},
+		{"javascript autolink", "<javascript:alert(1)>", "<p>&lt;javascript:alert(1)&gt;</p>"},
+		{"quote in link destination", `[x](https://example.com/"onmouseover="alert(1))`,
+			`<p><a href="https://example.com/&#34;onmouseover=&#34;alert(1">x</a>)</p>`},
+		{"raw HTML escaped", "<script>alert(1)</script> & <b onclick=\"x\">b</b>",
+			"<p>&lt;script&gt;alert(1)&lt;/script&gt; &amp; &lt;b onclick=&#34;x&#34;&gt;b&lt;/b&gt;</p>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := markdownToHTML(test.source); got != test.want {
+				t.Errorf("markdownToHTML(%q)\n got %q\nwant %q", test.source, got, test.want)
+			}
+		})
+	}
+}
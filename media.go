@@ -0,0 +1,120 @@
+// media.go
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// audioHandler serves the audio files of a podcast's known episodes. prefix is the route
+// the files are served under, e.g. "/my-show/audio/".
+func audioHandler(podcastName, prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rel, ok := mediaRelPath(r, prefix)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		configMu.RLock()
+		podcast := config.Podcasts[podcastName]
+		configMu.RUnlock()
+
+		target := filepath.Join(podcast.AudioDir, filepath.FromSlash(rel))
+		for _, episode := range podcast.Episodes {
+			if filepath.Clean(episode.FilePath) != target {
+				continue
+			}
+			mimeType, supported := supportedAudioExts[strings.ToLower(filepath.Ext(target))]
+			if !supported {
+				break
+			}
+			recordDownload(r, podcastName, rel, episode.FileSize)
+			serveMediaFile(w, r, target, mimeType)
+			return
+		}
+
+		http.NotFound(w, r)
+	})
+}
+
+// artworkHandler serves the artwork extracted from a podcast's episodes by scanAudioFiles,
+// and the cover uploaded in the admin UI
+func artworkHandler(podcastName, prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rel, ok := mediaRelPath(r, prefix)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		configMu.RLock()
+		podcast := config.Podcasts[podcastName]
+		configMu.RUnlock()
+
+		// Covers uploaded in the admin UI are stored next to the episode artwork
+		if podcast.ImageURL == strings.TrimSuffix(podcast.BaseURL, "/")+"/artwork/"+rel {
+			serveMediaFile(w, r, filepath.Join(podcast.AudioDir, ".artwork", filepath.Base(rel)), "")
+			return
+		}
+
+		for _, episode := range podcast.Episodes {
+			if episode.ImageURL == "" {
+				continue
+			}
+			audioRel, err := filepath.Rel(podcast.AudioDir, episode.FilePath)
+			if err != nil {
+				continue
+			}
+			artworkRel := filepath.ToSlash(strings.TrimSuffix(audioRel, filepath.Ext(audioRel))) + "_artwork.jpg"
+			if artworkRel != rel {
+				continue
+			}
+			// saveEpisodeArtwork stores artwork flat in .artwork, under the file's base name
+			serveMediaFile(w, r, filepath.Join(podcast.AudioDir, ".artwork", filepath.Base(rel)), "")
+			return
+		}
+
+		http.NotFound(w, r)
+	})
+}
+
+// mediaRelPath returns the file path a media request asks for, relative to the route
+// prefix. Directory indexes, dotfiles and paths escaping the directory are refused.
+func mediaRelPath(r *http.Request, prefix string) (string, bool) {
+	rel, found := strings.CutPrefix(r.URL.Path, prefix)
+	if !found || rel == "" || strings.HasSuffix(rel, "/") {
+		return "", false
+	}
+	for _, segment := range strings.Split(rel, "/") {
+		if segment == "" || strings.HasPrefix(segment, ".") {
+			return "", false
+		}
+	}
+	return rel, true
+}
+
+// serveMediaFile serves a regular file with range support. An empty contentType lets
+// http.ServeContent pick one from the file name.
+func serveMediaFile(w http.ResponseWriter, r *http.Request, path, contentType string) {
+	file, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
@@ -0,0 +1,174 @@
+// metrics.go
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/cobra"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chopchop_http_requests_total",
+		Help: "HTTP requests by route and status code.",
+	}, []string{"route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chopchop_http_request_duration_seconds",
+		Help:    "Time spent serving HTTP requests, by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route"})
+
+	renderDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chopchop_feed_render_duration_seconds",
+		Help:    "Time spent rendering feeds and podcasts.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"feed", "kind"})
+
+	podcastBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chopchop_podcast_bytes_served_total",
+		Help: "Audio and artwork bytes served per podcast.",
+	}, []string{"podcast"})
+
+	configReloads = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chopchop_config_reloads_total",
+		Help: "Times the server re-read the config file before changing it.",
+	})
+
+	configReloadFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chopchop_config_reload_failures_total",
+		Help: "Config file re-reads that failed, leaving the in-memory config in use.",
+	})
+
+	scanDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chopchop_refresh_scan_duration_seconds",
+		Help:    "Time spent scanning podcast audio directories.",
+		Buckets: []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300},
+	}, []string{"podcast"})
+
+	podcastEpisodes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "chopchop_podcast_episodes",
+		Help: "Episodes per podcast as of the last scan or server start.",
+	}, []string{"podcast"})
+
+	rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chopchop_rate_limited_total",
+		Help: "Requests answered with 429, by the limit they hit.",
+	}, []string{"reason"})
+)
+
+// statusRecorder captures the status code and body size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// metricsMiddleware records the count and duration of requests to a route
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		httpRequests.WithLabelValues(route, strconv.Itoa(rec.status)).Inc()
+		httpDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// countPodcastBytes adds the bytes served by a media handler to its podcast's total
+func countPodcastBytes(podcastName string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		podcastBytes.WithLabelValues(podcastName).Add(float64(rec.bytes))
+	})
+}
+
+// observeRender records how long rendering a feed or podcast took
+func observeRender(name, kind string, start time.Time) {
+	renderDuration.WithLabelValues(name, kind).Observe(time.Since(start).Seconds())
+}
+
+// scanPodcast scans a podcast's audio directory, recording the scan duration and episode count
+func scanPodcast(name, audioDir, baseURL string) ([]Episode, error) {
+	start := time.Now()
+	episodes, err := scanAudioFiles(audioDir, baseURL)
+	scanDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	if err == nil {
+		podcastEpisodes.WithLabelValues(name).Set(float64(len(episodes)))
+	}
+	return episodes, err
+}
+
+// setEpisodeGauges publishes the episode count of every podcast
+func setEpisodeGauges() {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
+	for name, podcast := range config.Podcasts {
+		podcastEpisodes.WithLabelValues(name).Set(float64(len(podcast.Episodes)))
+	}
+}
+
+// serveMetrics exposes /metrics on the main router, or on its own address when one is given
+func serveMetrics(cmd *cobra.Command, r *mux.Router, addr string) error {
+	if addr == "" {
+		r.Handle("/metrics", promhttp.Handler())
+		return nil
+	}
+
+	listener, err := listen(cmd, addr)
+	if err != nil {
+		return err
+	}
+
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		slog.Info("Serving metrics at /metrics", "listen", listenerURL(listener, "http"))
+		server := &http.Server{Handler: metricsMux, ReadHeaderTimeout: defaultReadHeaderTimeout}
+		if err := server.Serve(listener); err != nil {
+			slog.Error("Metrics server failed", "error", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,424 @@
+// mirror.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Remote describes where a mirrored feed is fetched from and the state of the last fetch
+type Remote struct {
+	URL          string        `json:"url"`
+	Interval     time.Duration `json:"interval"`
+	ETag         string        `json:"etag,omitempty"`
+	LastModified string        `json:"lastModified,omitempty"`
+	LastFetched  time.Time     `json:"lastFetched,omitempty"`
+	LastError    string        `json:"lastError,omitempty"`
+	MaxItems     int           `json:"maxItems,omitempty"` // Items kept, 0 for defaultRemoteMaxItems
+}
+
+// Default polling interval for mirrored feeds
+const defaultRemoteInterval = 30 * time.Minute
+
+// Default number of items a mirrored feed keeps
+const defaultRemoteMaxItems = 500
+
+// How often serve looks for remote feeds that were created or deleted
+const remoteRescanInterval = time.Minute
+
+// Largest feed document we're willing to download
+const maxRemoteFeedSize = 10 << 20
+
+var remoteClient = &http.Client{Timeout: 30 * time.Second}
+
+// createRemoteFeed creates a feed that mirrors a third-party RSS or Atom feed
+func createRemoteFeed(cmd *cobra.Command, args []string) {
+	name, _ := cmd.Flags().GetString("name")
+	feedURL, _ := cmd.Flags().GetString("url")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	title, _ := cmd.Flags().GetString("title")
+	maxItems, _ := cmd.Flags().GetInt("max-items")
+
+	if err := validFeedName(name); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if _, exists := config.Feeds[name]; exists {
+		fmt.Printf("Feed '%s' already exists\n", name)
+		return
+	}
+
+	if interval < time.Minute {
+		fmt.Println("Polling interval must be at least 1m")
+		return
+	}
+	if maxItems < 1 {
+		fmt.Println("Max items must be at least 1")
+		return
+	}
+
+	now := time.Now()
+	feed := Feed{
+		Title:   title,
+		Created: now,
+		Updated: now,
+		Items:   []Item{},
+		Remote:  &Remote{URL: feedURL, Interval: interval, MaxItems: maxItems},
+	}
+
+	fmt.Printf("Fetching %s...\n", feedURL)
+	if _, _, err := syncRemoteFeed(&feed); err != nil {
+		fmt.Printf("Failed to fetch remote feed: %v\n", err)
+		return
+	}
+
+	config.Feeds[name] = feed
+	saveConfig()
+	emitFeedEvent(eventFeedCreated, name, "feed")
+	fmt.Printf("Remote feed '%s' created with %d items\n", name, len(feed.Items))
+}
+
+// refreshRemoteFeed fetches a mirrored feed immediately
+func refreshRemoteFeed(cmd *cobra.Command, args []string) {
+	name, _ := cmd.Flags().GetString("name")
+
+	feed, exists := config.Feeds[name]
+	if !exists {
+		fmt.Printf("Feed '%s' does not exist\n", name)
+		return
+	}
+	if feed.Remote == nil {
+		fmt.Printf("Feed '%s' is not a remote feed\n", name)
+		return
+	}
+
+	fmt.Printf("Fetching %s...\n", feed.Remote.URL)
+	added, updated, err := syncRemoteFeed(&feed)
+	config.Feeds[name] = feed
+	saveConfig()
+	if err != nil {
+		fmt.Printf("Failed to fetch remote feed: %v\n", err)
+		return
+	}
+	emitItemEvents(name, added, updated)
+	fmt.Printf("Remote feed '%s' refreshed, %d new items (%d total)\n", name, len(added), len(feed.Items))
+}
+
+// remoteFetch is the outcome of fetching an upstream feed document
+type remoteFetch struct {
+	Feed         *Feed // nil when the upstream answered 304 Not Modified
+	ETag         string
+	LastModified string
+	Err          error
+}
+
+// syncRemoteFeed fetches the upstream document of a mirrored feed and merges its items
+func syncRemoteFeed(feed *Feed) ([]Item, []Item, error) {
+	result := fetchRemoteFeed(*feed.Remote)
+	added, updated := applyRemoteFetch(feed, result)
+	return added, updated, result.Err
+}
+
+// fetchRemoteFeed performs a conditional GET of the upstream feed document
+func fetchRemoteFeed(remote Remote) remoteFetch {
+	result := remoteFetch{ETag: remote.ETag, LastModified: remote.LastModified}
+
+	req, err := http.NewRequest(http.MethodGet, remote.URL, nil)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	req.Header.Set("User-Agent", "ChopChopRSS")
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, */*;q=0.8")
+	if remote.ETag != "" {
+		req.Header.Set("If-None-Match", remote.ETag)
+	}
+	if remote.LastModified != "" {
+		req.Header.Set("If-Modified-Since", remote.LastModified)
+	}
+
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return result
+	}
+	if resp.StatusCode != http.StatusOK {
+		result.Err = fmt.Errorf("unexpected status %s", resp.Status)
+		return result
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteFeedSize))
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	upstream, _, err := parseFeedDocument(data, false)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.Feed = upstream
+	result.ETag = resp.Header.Get("ETag")
+	result.LastModified = resp.Header.Get("Last-Modified")
+	return result
+}
+
+// applyRemoteFetch records a fetch on the feed and merges any upstream items.
+// It returns the items that were added and the items that were updated.
+func applyRemoteFetch(feed *Feed, result remoteFetch) ([]Item, []Item) {
+	remote := *feed.Remote
+	remote.LastFetched = time.Now()
+	feed.Remote = &remote
+
+	if result.Err != nil {
+		remote.LastError = result.Err.Error()
+		return nil, nil
+	}
+	remote.LastError = ""
+	remote.ETag = result.ETag
+	remote.LastModified = result.LastModified
+
+	upstream := result.Feed
+	if upstream == nil {
+		return nil, nil
+	}
+
+	// Keep local overrides, fill in anything that wasn't set from upstream
+	if feed.Title == "" {
+		feed.Title = upstream.Title
+	}
+	if feed.Description == "" {
+		feed.Description = upstream.Description
+	}
+	if feed.Link == "" {
+		feed.Link = upstream.Link
+	}
+	if feed.Author == "" {
+		feed.Author = upstream.Author
+	}
+	if feed.Email == "" {
+		feed.Email = upstream.Email
+	}
+
+	return mergeRemoteItems(feed, upstream.Items)
+}
+
+// mergeRemoteItems adds new upstream items to a feed and replaces items that changed,
+// matching them by GUID or link. It returns the items added and the items updated.
+func mergeRemoteItems(feed *Feed, upstream []Item) ([]Item, []Item) {
+	items := make([]Item, len(feed.Items))
+	copy(items, feed.Items)
+
+	index := make(map[string]int)
+	for i, item := range items {
+		index[remoteItemKey(item)] = i
+	}
+
+	var added, updated []Item
+	for _, item := range upstream {
+		key := remoteItemKey(item)
+		if i, exists := index[key]; exists {
+			if existing := items[i]; existing.Title != item.Title || existing.Content != item.Content ||
+				existing.Description != item.Description || existing.ImageURL != item.ImageURL {
+				item.Created = existing.Created
+				items[i] = item
+				updated = append(updated, item)
+			}
+			continue
+		}
+		index[key] = len(items)
+		items = append(items, item)
+		added = append(added, item)
+	}
+
+	pruned := pruneRemoteItems(items, upstream, feed.Remote.MaxItems)
+	if len(added) > 0 || len(updated) > 0 || len(pruned) < len(items) {
+		feed.Items = pruned
+		feed.Updated = time.Now()
+	}
+	return added, updated
+}
+
+// pruneRemoteItems drops the oldest items beyond maxItems, or defaultRemoteMaxItems when
+// it is 0. Items still in the upstream document are always kept, so they aren't added
+// again by the next fetch.
+func pruneRemoteItems(items, upstream []Item, maxItems int) []Item {
+	if maxItems <= 0 {
+		maxItems = defaultRemoteMaxItems
+	}
+	if len(items) <= maxItems {
+		return items
+	}
+
+	current := make(map[string]bool, len(upstream))
+	for _, item := range upstream {
+		current[remoteItemKey(item)] = true
+	}
+
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return items[order[i]].Created.Before(items[order[j]].Created)
+	})
+
+	drop := make(map[int]bool)
+	for _, i := range order {
+		if len(items)-len(drop) <= maxItems {
+			break
+		}
+		if !current[remoteItemKey(items[i])] {
+			drop[i] = true
+		}
+	}
+
+	kept := make([]Item, 0, len(items)-len(drop))
+	for i, item := range items {
+		if !drop[i] {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// remoteItemKey identifies a mirrored item by GUID or link, falling back to its title for
+// upstream items that have neither. Dates aren't part of the key, since undated items get
+// the time they were fetched.
+func remoteItemKey(item Item) string {
+	if key := itemKey(item); key != "" {
+		return key
+	}
+	return "title:" + item.Title
+}
+
+// startRemotePolling polls every mirrored feed on its own interval until ctx is done
+func startRemotePolling(ctx context.Context) {
+	go superviseRemotePolling(ctx)
+}
+
+// remotePoller is a running pollRemoteFeed goroutine
+type remotePoller struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// superviseRemotePolling reloads the config every remoteRescanInterval, so remote feeds
+// created or deleted by other commands while serve runs start or stop being polled
+func superviseRemotePolling(ctx context.Context) {
+	pollers := make(map[string]remotePoller)
+	ticker := time.NewTicker(remoteRescanInterval)
+	defer ticker.Stop()
+
+	for first := true; ; first = false {
+		configMu.Lock()
+		if !first {
+			reloadConfig()
+		}
+		remotes := make(map[string]bool)
+		for name, feed := range config.Feeds {
+			if feed.Remote != nil {
+				remotes[name] = true
+			}
+		}
+		configMu.Unlock()
+
+		for name, poller := range pollers {
+			select {
+			case <-poller.done:
+				delete(pollers, name)
+				continue
+			default:
+			}
+			if !remotes[name] {
+				poller.cancel()
+				delete(pollers, name)
+			}
+		}
+		for name := range remotes {
+			if _, running := pollers[name]; running {
+				continue
+			}
+			pollCtx, cancel := context.WithCancel(ctx)
+			poller := remotePoller{cancel: cancel, done: make(chan struct{})}
+			pollers[name] = poller
+			go func(name string) {
+				defer close(poller.done)
+				pollRemoteFeed(pollCtx, name)
+			}(name)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			for _, poller := range pollers {
+				poller.cancel()
+			}
+			return
+		}
+	}
+}
+
+// pollRemoteFeed keeps one mirrored feed up to date
+func pollRemoteFeed(ctx context.Context, name string) {
+	for ctx.Err() == nil {
+		configMu.RLock()
+		feed, exists := config.Feeds[name]
+		configMu.RUnlock()
+		if !exists || feed.Remote == nil {
+			slog.Info("Remote feed was removed, stopping polling", "feed", name)
+			return
+		}
+
+		interval := feed.Remote.Interval
+		if interval <= 0 {
+			interval = defaultRemoteInterval
+		}
+
+		if wait := time.Until(feed.Remote.LastFetched.Add(interval)); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		if err := fetchAndMergeRemoteFeed(name, *feed.Remote); err != nil {
+			slog.Warn("Failed to fetch remote feed", "feed", name, "error", err)
+		}
+	}
+}
+
+// fetchAndMergeRemoteFeed fetches a mirrored feed from inside the server without holding
+// the config lock, then merges the result into the latest config
+func fetchAndMergeRemoteFeed(name string, remote Remote) error {
+	result := fetchRemoteFeed(remote)
+
+	updateConfig(func() {
+		current, exists := config.Feeds[name]
+		if !exists || current.Remote == nil {
+			return
+		}
+		added, updated := applyRemoteFetch(&current, result)
+		if len(added) > 0 {
+			slog.Info("Fetched new items for remote feed", "feed", name, "items", len(added))
+		}
+		emitItemEvents(name, added, updated)
+		config.Feeds[name] = current
+	})
+	return result.Err
+}
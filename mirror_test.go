@@ -0,0 +1,162 @@
+// mirror_test.go
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// upstreamRSS builds an RSS document with an item identified by GUID, one identified only
+// by its link and one with neither, and no dates
+func upstreamRSS(guidDescription string) string {
+	return fmt.Sprintf(`<?xml version="1.0"?>
+<rss version="2.0"><channel>
+<title>Upstream</title><link>https://example.com/</link><description>Upstream feed</description>
+<item><title>By GUID</title><guid>item-1</guid><description>%s</description></item>
+<item><title>By link</title><link>https://example.com/2</link><description>Second</description></item>
+<item><title>Bare</title><description>Third</description></item>
+</channel></rss>`, guidDescription)
+}
+
+// newUpstream serves doc with an ETag and answers 304 to matching conditional requests
+func newUpstream(t *testing.T, doc *atomic.Value) (*httptest.Server, *atomic.Int32) {
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		body := doc.Load().(string)
+		etag := fmt.Sprintf(`"%x"`, len(body))
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &fetches
+}
+
+func newMirroredFeed(url string) Feed {
+	return Feed{Items: []Item{}, Remote: &Remote{URL: url, Interval: time.Minute}}
+}
+
+func TestSyncRemoteFeedNotModified(t *testing.T) {
+	var doc atomic.Value
+	doc.Store(upstreamRSS("First"))
+	server, fetches := newUpstream(t, &doc)
+
+	feed := newMirroredFeed(server.URL)
+	added, _, err := syncRemoteFeed(&feed)
+	if err != nil {
+		t.Fatalf("first fetch: %v", err)
+	}
+	if len(added) != 3 || feed.Remote.ETag == "" {
+		t.Fatalf("first fetch added %d items with ETag %q, want 3 items and an ETag", len(added), feed.Remote.ETag)
+	}
+
+	added, updated, err := syncRemoteFeed(&feed)
+	if err != nil {
+		t.Fatalf("second fetch: %v", err)
+	}
+	if fetches.Load() != 2 {
+		t.Fatalf("upstream fetched %d times, want 2", fetches.Load())
+	}
+	if len(added) != 0 || len(updated) != 0 || len(feed.Items) != 3 {
+		t.Errorf("304 added %d and updated %d items, feed has %d, want 0, 0 and 3", len(added), len(updated), len(feed.Items))
+	}
+	if feed.Remote.ETag == "" || feed.Remote.LastError != "" {
+		t.Errorf("304 left ETag %q and error %q, want the ETag kept and no error", feed.Remote.ETag, feed.Remote.LastError)
+	}
+}
+
+func TestSyncRemoteFeedDeduplicates(t *testing.T) {
+	var doc atomic.Value
+	doc.Store(upstreamRSS("First"))
+	server, _ := newUpstream(t, &doc)
+
+	feed := newMirroredFeed(server.URL)
+	for i := 0; i < 3; i++ {
+		// Drop the validators so every fetch returns the full document
+		feed.Remote.ETag, feed.Remote.LastModified = "", ""
+		if _, _, err := syncRemoteFeed(&feed); err != nil {
+			t.Fatalf("fetch %d: %v", i, err)
+		}
+	}
+	if len(feed.Items) != 3 {
+		t.Errorf("feed has %d items after three full fetches, want 3", len(feed.Items))
+	}
+}
+
+func TestSyncRemoteFeedUpdatesChangedItems(t *testing.T) {
+	var doc atomic.Value
+	doc.Store(upstreamRSS("First"))
+	server, _ := newUpstream(t, &doc)
+
+	feed := newMirroredFeed(server.URL)
+	if _, _, err := syncRemoteFeed(&feed); err != nil {
+		t.Fatalf("first fetch: %v", err)
+	}
+	created := feed.Items[0].Created
+
+	doc.Store(upstreamRSS("First, corrected"))
+	added, updated, err := syncRemoteFeed(&feed)
+	if err != nil {
+		t.Fatalf("second fetch: %v", err)
+	}
+	if len(added) != 0 || len(updated) != 1 {
+		t.Fatalf("changed upstream added %d and updated %d items, want 0 and 1", len(added), len(updated))
+	}
+	if item := feed.Items[0]; item.Description != "First, corrected" || !item.Created.Equal(created) {
+		t.Errorf("updated item has description %q and created %v, want %q and %v", item.Description, item.Created, "First, corrected", created)
+	}
+}
+
+func TestSyncRemoteFeedError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusGone)
+	}))
+	defer server.Close()
+
+	feed := newMirroredFeed(server.URL)
+	if _, _, err := syncRemoteFeed(&feed); err == nil {
+		t.Fatal("fetch of a failing upstream succeeded")
+	}
+	if feed.Remote.LastError == "" || feed.Remote.LastFetched.IsZero() {
+		t.Errorf("failed fetch recorded error %q at %v, want both set", feed.Remote.LastError, feed.Remote.LastFetched)
+	}
+}
+
+func TestSyncRemoteFeedPrunesOldItems(t *testing.T) {
+	var doc atomic.Value
+	doc.Store(upstreamRSS("First"))
+	server, _ := newUpstream(t, &doc)
+
+	feed := newMirroredFeed(server.URL)
+	feed.Remote.MaxItems = 4
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 3; i >= 1; i-- {
+		feed.Items = append(feed.Items, Item{Title: fmt.Sprintf("Old %d", i), GUID: fmt.Sprintf("old-%d", i), Created: old.AddDate(0, 0, -i)})
+	}
+
+	if _, _, err := syncRemoteFeed(&feed); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if len(feed.Items) != 4 || feed.Items[0].Title != "Old 1" {
+		t.Fatalf("feed kept %d items starting with %q, want 4 starting with the newest old item", len(feed.Items), feed.Items[0].Title)
+	}
+
+	// Items still upstream are kept even when they alone exceed the limit
+	feed.Remote.MaxItems = 1
+	doc.Store(upstreamRSS("First, corrected"))
+	if _, _, err := syncRemoteFeed(&feed); err != nil {
+		t.Fatalf("second fetch: %v", err)
+	}
+	if len(feed.Items) != 3 {
+		t.Errorf("feed kept %d items, want the 3 items still upstream", len(feed.Items))
+	}
+}
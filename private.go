@@ -0,0 +1,307 @@
+// private.go
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Subscriber is someone allowed to read a private feed or podcast
+type Subscriber struct {
+	ID      string    `json:"id"`    // Public identifier carried by signed media URLs
+	Name    string    `json:"name"`  // Who the token was issued to
+	Token   string    `json:"token"` // Secret embedded in the feed URL
+	Created time.Time `json:"created"`
+}
+
+// SubscriberAccess is one authorized request, as recorded in the access log
+type SubscriberAccess struct {
+	Time       time.Time `json:"time"`
+	Feed       string    `json:"feed"`
+	Subscriber string    `json:"subscriber"`
+	ID         string    `json:"id"`
+	Path       string    `json:"path"`
+	RemoteAddr string    `json:"remoteAddr"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+}
+
+var accessLogMu sync.Mutex
+
+// accessLogPath returns the path of the subscriber access log, next to the config file
+func accessLogPath() string {
+	return filepath.Join(filepath.Dir(cfgFile), "subscriber-access.log")
+}
+
+// feedAccess returns whether a feed or podcast is private and who may read it.
+// Callers running inside the server must hold configMu.
+func feedAccess(name string) (bool, []Subscriber, bool) {
+	if feed, exists := config.Feeds[name]; exists {
+		return feed.Private, feed.Subscribers, true
+	}
+	if podcast, exists := config.Podcasts[name]; exists {
+		return podcast.Private, podcast.Subscribers, true
+	}
+	return false, nil, false
+}
+
+// setFeedAccess stores the access settings of a feed or podcast
+func setFeedAccess(name string, private bool, subscribers []Subscriber) {
+	if feed, exists := config.Feeds[name]; exists {
+		feed.Private = private
+		feed.Subscribers = subscribers
+		config.Feeds[name] = feed
+		return
+	}
+	if podcast, exists := config.Podcasts[name]; exists {
+		podcast.Private = private
+		podcast.Subscribers = subscribers
+		config.Podcasts[name] = podcast
+	}
+}
+
+// authorizeSubscriber checks the token of a request for a feed or podcast. It returns
+// the subscriber (nil for public feeds) and false after writing an error response.
+func authorizeSubscriber(w http.ResponseWriter, r *http.Request, name string) (*Subscriber, bool) {
+	configMu.RLock()
+	private, subscribers, _ := feedAccess(name)
+	configMu.RUnlock()
+	if !private {
+		return nil, true
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "This feed is private, subscribe with your personal feed URL", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	for i := range subscribers {
+		if subtle.ConstantTimeCompare([]byte(subscribers[i].Token), []byte(token)) == 1 {
+			logSubscriberAccess(r, name, subscribers[i])
+			return &subscribers[i], true
+		}
+	}
+
+	slog.Warn("Rejected invalid subscriber token", "feed", name, "remote", remoteHost(r))
+	http.Error(w, "Invalid or revoked token", http.StatusForbidden)
+	return nil, false
+}
+
+// logSubscriberAccess appends an authorized request to the access log
+func logSubscriberAccess(r *http.Request, name string, subscriber Subscriber) {
+	data, err := json.Marshal(SubscriberAccess{
+		Time:       time.Now().UTC(),
+		Feed:       name,
+		Subscriber: subscriber.Name,
+		ID:         subscriber.ID,
+		Path:       r.URL.Path,
+		RemoteAddr: remoteHost(r),
+		UserAgent:  r.UserAgent(),
+	})
+	if err != nil {
+		return
+	}
+
+	accessLogMu.Lock()
+	defer accessLogMu.Unlock()
+
+	path := accessLogPath()
+	if err := rotateLog(path); err != nil {
+		slog.Error("Failed to rotate subscriber access log", "error", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Error("Failed to open subscriber access log", "error", err)
+		return
+	}
+	defer file.Close()
+
+	file.Write(append(data, '\n'))
+}
+
+// privateFeedURL returns the URL a subscriber should add to their reader. Feeds need the
+// server's public URL, podcasts have their own base URL.
+func privateFeedURL(name string, subscriber Subscriber) (string, error) {
+	base := ""
+	if _, isFeed := config.Feeds[name]; !isFeed && config.Podcasts[name].BaseURL != "" {
+		base = config.Podcasts[name].BaseURL
+	} else if publicURL := serverPublicURL(); publicURL != "" {
+		base = publicURL + "/" + name
+	} else {
+		return "", fmt.Errorf("The server's public URL is unknown, set it with 'chopchoprss set-public-url --url https://feeds.example.com'")
+	}
+	return base + "?token=" + subscriber.Token, nil
+}
+
+// setPrivate marks a feed or podcast as private or public
+func setPrivate(cmd *cobra.Command, args []string) {
+	name, _ := cmd.Flags().GetString("name")
+	disable, _ := cmd.Flags().GetBool("disable")
+
+	_, subscribers, exists := feedAccess(name)
+	if !exists {
+		fmt.Printf("Feed or podcast '%s' does not exist\n", name)
+		return
+	}
+
+	setFeedAccess(name, !disable, subscribers)
+	saveConfig()
+
+	if disable {
+		fmt.Printf("'%s' is now public\n", name)
+		return
+	}
+	fmt.Printf("'%s' is now private, readable by %d subscribers\n", name, len(subscribers))
+	if len(subscribers) == 0 {
+		fmt.Println("Use create-subscriber to issue access tokens")
+	}
+}
+
+// createSubscriber issues a personal access token for a private feed or podcast
+func createSubscriber(cmd *cobra.Command, args []string) {
+	feedName, _ := cmd.Flags().GetString("feed")
+	name, _ := cmd.Flags().GetString("name")
+
+	private, subscribers, exists := feedAccess(feedName)
+	if !exists {
+		fmt.Printf("Feed or podcast '%s' does not exist\n", feedName)
+		return
+	}
+
+	for _, subscriber := range subscribers {
+		if subscriber.Name == name {
+			fmt.Printf("Subscriber '%s' already exists for '%s'\n", name, feedName)
+			return
+		}
+	}
+
+	subscriber := Subscriber{
+		ID:      randomHex(4),
+		Name:    name,
+		Token:   randomHex(24),
+		Created: time.Now(),
+	}
+	feedURL, err := privateFeedURL(feedName, subscriber)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	subscribers = append(subscribers, subscriber)
+
+	setFeedAccess(feedName, private, subscribers)
+	saveConfig()
+
+	fmt.Printf("Subscriber '%s' created for '%s'\n", name, feedName)
+	fmt.Printf("Feed URL: %s\n", feedURL)
+	if !private {
+		fmt.Printf("Note: '%s' is public, use set-private to require tokens\n", feedName)
+	}
+}
+
+// revokeSubscriber removes a subscriber, invalidating their feed URL and signed media URLs
+func revokeSubscriber(cmd *cobra.Command, args []string) {
+	feedName, _ := cmd.Flags().GetString("feed")
+	name, _ := cmd.Flags().GetString("name")
+
+	private, subscribers, exists := feedAccess(feedName)
+	if !exists {
+		fmt.Printf("Feed or podcast '%s' does not exist\n", feedName)
+		return
+	}
+
+	for i, subscriber := range subscribers {
+		if subscriber.Name == name {
+			subscribers = append(subscribers[:i], subscribers[i+1:]...)
+			setFeedAccess(feedName, private, subscribers)
+			saveConfig()
+			fmt.Printf("Subscriber '%s' revoked from '%s'\n", name, feedName)
+			return
+		}
+	}
+
+	fmt.Printf("Subscriber '%s' does not exist for '%s'\n", name, feedName)
+}
+
+// listSubscribers lists the subscribers of a feed or podcast
+func listSubscribers(cmd *cobra.Command, args []string) {
+	feedName, _ := cmd.Flags().GetString("feed")
+
+	private, subscribers, exists := feedAccess(feedName)
+	if !exists {
+		fmt.Printf("Feed or podcast '%s' does not exist\n", feedName)
+		return
+	}
+
+	visibility := "public"
+	if private {
+		visibility = "private"
+	}
+
+	if len(subscribers) == 0 {
+		fmt.Printf("No subscribers for '%s' (%s)\n", feedName, visibility)
+		return
+	}
+
+	fmt.Printf("Subscribers of '%s' (%s):\n", feedName, visibility)
+	for _, subscriber := range subscribers {
+		fmt.Printf("- %s [%s] created %s\n", subscriber.Name, subscriber.ID, subscriber.Created.Format("2006-01-02"))
+	}
+}
+
+// subscriberLog prints the most recent authorized requests to private feeds
+func subscriberLog(cmd *cobra.Command, args []string) {
+	feedName, _ := cmd.Flags().GetString("feed")
+	name, _ := cmd.Flags().GetString("name")
+	limit, _ := cmd.Flags().GetInt("limit")
+
+	// Read the rotated log first, so the newest requests come last
+	var accesses []SubscriberAccess
+	found := false
+	for _, path := range []string{accessLogPath() + ".1", accessLogPath()} {
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Failed to open subscriber access log: %v\n", err)
+			return
+		}
+		found = true
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var access SubscriberAccess
+			if err := json.Unmarshal(scanner.Bytes(), &access); err != nil {
+				continue
+			}
+			if (feedName != "" && access.Feed != feedName) || (name != "" && access.Subscriber != name) {
+				continue
+			}
+			accesses = append(accesses, access)
+			if limit > 0 && len(accesses) > limit {
+				accesses = accesses[1:]
+			}
+		}
+		file.Close()
+	}
+	if !found {
+		fmt.Println("No subscriber access recorded yet")
+		return
+	}
+
+	for _, a := range accesses {
+		fmt.Printf("%s %s %s [%s] %s from %s (%s)\n",
+			a.Time.Local().Format("2006-01-02 15:04:05"), a.Feed, a.Subscriber, a.ID, a.Path, a.RemoteAddr, a.UserAgent)
+	}
+}
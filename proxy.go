@@ -0,0 +1,132 @@
+// proxy.go
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies are the reverse proxies serve takes client addresses from, set by --trusted-proxy
+var trustedProxies struct {
+	networks []*net.IPNet
+	unix     bool // Trust every connection arriving over a Unix socket
+}
+
+// parseTrustedProxies reads --trusted-proxy values: CIDR ranges, single addresses, or
+// unix for connections over Unix sockets
+func parseTrustedProxies(values []string) error {
+	trustedProxies.networks, trustedProxies.unix = nil, false
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "unix" {
+			trustedProxies.unix = true
+			continue
+		}
+		if strings.Contains(value, "/") {
+			_, ipNet, err := net.ParseCIDR(value)
+			if err != nil {
+				return fmt.Errorf("invalid trusted proxy '%s': %v", value, err)
+			}
+			trustedProxies.networks = append(trustedProxies.networks, ipNet)
+			continue
+		}
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return fmt.Errorf("invalid trusted proxy '%s', use a CIDR range, an address or unix", value)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		trustedProxies.networks = append(trustedProxies.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return nil
+}
+
+// trustedProxyAddress reports whether an address belongs to a trusted proxy
+func trustedProxyAddress(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range trustedProxies.networks {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromTrustedProxy reports whether a request came straight from a trusted proxy
+func fromTrustedProxy(r *http.Request, host string) bool {
+	if trustedProxies.unix {
+		if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && addr.Network() == "unix" {
+			return true
+		}
+	}
+	return trustedProxyAddress(host)
+}
+
+// remoteHost returns the client address of a request without its port. Requests from a
+// trusted proxy are attributed to the rightmost forwarded address that isn't itself a
+// trusted proxy, so clients can't pick their address by sending the headers themselves.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !fromTrustedProxy(r, host) {
+		return host
+	}
+
+	hops := forwardedHops(r)
+	for i := len(hops) - 1; i >= 0; i-- {
+		host = hops[i]
+		if !trustedProxyAddress(host) {
+			break
+		}
+	}
+	return host
+}
+
+// forwardedHops returns the client addresses proxies recorded in X-Forwarded-For, or in
+// Forwarded when there is no X-Forwarded-For, oldest first
+func forwardedHops(r *http.Request) []string {
+	var hops []string
+	if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		for _, value := range values {
+			for _, hop := range strings.Split(value, ",") {
+				if hop = forwardedAddress(hop); hop != "" {
+					hops = append(hops, hop)
+				}
+			}
+		}
+		return hops
+	}
+
+	for _, value := range r.Header.Values("Forwarded") {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, hop, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if !found || !strings.EqualFold(key, "for") {
+					continue
+				}
+				if hop = forwardedAddress(hop); hop != "" {
+					hops = append(hops, hop)
+				}
+			}
+		}
+	}
+	return hops
+}
+
+// forwardedAddress strips quotes, brackets and ports from a forwarded address
+func forwardedAddress(value string) string {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+}
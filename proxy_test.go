@@ -0,0 +1,89 @@
+// proxy_test.go
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRemoteHost(t *testing.T) {
+	if err := parseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "unix"}); err != nil {
+		t.Fatalf("parseTrustedProxies: %v", err)
+	}
+	t.Cleanup(func() { parseTrustedProxies(nil) })
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		unix       bool
+		headers    map[string]string
+		want       string
+	}{
+		{"direct client", "203.0.113.5:4000", false, nil, "203.0.113.5"},
+		{"untrusted client sending X-Forwarded-For", "203.0.113.5:4000", false, map[string]string{"X-Forwarded-For": "198.51.100.7"}, "203.0.113.5"},
+		{"trusted proxy", "192.0.2.1:4000", false, map[string]string{"X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+		{"spoofed hop before the proxy's", "10.1.2.3:4000", false, map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7"}, "198.51.100.7"},
+		{"chain of trusted proxies", "10.1.2.3:4000", false, map[string]string{"X-Forwarded-For": "198.51.100.7, 10.9.9.9"}, "198.51.100.7"},
+		{"trusted proxy without header", "192.0.2.1:4000", false, nil, "192.0.2.1"},
+		{"Forwarded", "192.0.2.1:4000", false, map[string]string{"Forwarded": `for="[2001:db8::1]:443";proto=https`}, "2001:db8::1"},
+		{"X-Forwarded-For wins over Forwarded", "192.0.2.1:4000", false, map[string]string{"X-Forwarded-For": "198.51.100.7", "Forwarded": "for=1.2.3.4"}, "198.51.100.7"},
+		{"Unix socket", "@", true, map[string]string{"X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/feed", nil)
+			r.RemoteAddr = test.remoteAddr
+			for name, value := range test.headers {
+				r.Header.Set(name, value)
+			}
+			if test.unix {
+				local := &net.UnixAddr{Name: "/run/chopchop.sock", Net: "unix"}
+				r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, local))
+			}
+			if got := remoteHost(r); got != test.want {
+				t.Errorf("remoteHost = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesRejectsInvalid(t *testing.T) {
+	t.Cleanup(func() { parseTrustedProxies(nil) })
+	for _, value := range []string{"10.0.0.0/33", "proxy.example.com", ""} {
+		if err := parseTrustedProxies([]string{value}); err == nil {
+			t.Errorf("parseTrustedProxies(%q) succeeded", value)
+		}
+	}
+}
+
+func TestPublicBaseURLTrustsForwardedProtoFromProxies(t *testing.T) {
+	if err := parseTrustedProxies([]string{"192.0.2.1"}); err != nil {
+		t.Fatalf("parseTrustedProxies: %v", err)
+	}
+	t.Cleanup(func() { parseTrustedProxies(nil) })
+	saved := config
+	t.Cleanup(func() { config = saved })
+	config = Config{}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		want       string
+	}{
+		{"trusted proxy", "192.0.2.1:4000", "https://feeds.example.com"},
+		{"untrusted client", "203.0.113.5:4000", "http://feeds.example.com"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://feeds.example.com/blog/", nil)
+			r.RemoteAddr = test.remoteAddr
+			r.Header.Set("X-Forwarded-Proto", "https")
+			if got := publicBaseURL(r); got != test.want {
+				t.Errorf("publicBaseURL = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// publicurl.go
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// serverPublicURL returns the base URL readers reach the server at, without a trailing
+// slash: the one set with set-public-url, or else the WebSub public URL, and "" when
+// neither is known. Callers running inside the server must hold configMu.
+func serverPublicURL() string {
+	if config.PublicURL != "" {
+		return strings.TrimSuffix(config.PublicURL, "/")
+	}
+	if config.WebSub != nil && config.WebSub.PublicURL != "" {
+		return strings.TrimSuffix(config.WebSub.PublicURL, "/")
+	}
+	return ""
+}
+
+// setPublicURL stores the base URL readers reach the server at
+func setPublicURL(cmd *cobra.Command, args []string) {
+	publicURL, _ := cmd.Flags().GetString("url")
+	clear, _ := cmd.Flags().GetBool("clear")
+
+	if clear {
+		config.PublicURL = ""
+		saveConfig()
+		fmt.Println("Public URL cleared")
+		return
+	}
+
+	u, err := url.Parse(publicURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fmt.Printf("Invalid public URL '%s', use an absolute URL like https://feeds.example.com\n", publicURL)
+		return
+	}
+
+	config.PublicURL = strings.TrimSuffix(publicURL, "/")
+	saveConfig()
+	fmt.Printf("Public URL set to %s\n", config.PublicURL)
+}
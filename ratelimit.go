@@ -0,0 +1,231 @@
+// ratelimit.go
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/time/rate"
+)
+
+// Clients idle for this long are forgotten, along with their rate limit state
+const clientIdleTimeout = 10 * time.Minute
+
+// Retry-After sent when a client has too many downloads open
+const downloadRetryAfter = 10 * time.Second
+
+// Largest chunk written at once to a throttled download, and the bandwidth burst
+const throttleChunk = 64 << 10
+
+// abuseLimits holds serve's per-IP request limits, download caps and bandwidth throttling.
+// Clients are told apart by remoteHost, which looks past --trusted-proxy proxies.
+type abuseLimits struct {
+	requestRate    rate.Limit
+	requestBurst   int
+	maxDownloads   int
+	clientBytes    rate.Limit // Audio bandwidth per client, 0 for unlimited
+	totalBandwidth *rate.Limiter
+
+	mu        sync.Mutex
+	clients   map[string]*clientLimits
+	lastSweep time.Time
+}
+
+// clientLimits is the rate limit state of one client address
+type clientLimits struct {
+	requests  *rate.Limiter
+	bandwidth *rate.Limiter
+	downloads int
+	lastSeen  time.Time
+}
+
+// newAbuseLimits reads the rate limit flags of serve
+func newAbuseLimits(cmd *cobra.Command) (*abuseLimits, error) {
+	requestRate, _ := cmd.Flags().GetFloat64("rate-limit")
+	requestBurst, _ := cmd.Flags().GetInt("rate-burst")
+	maxDownloads, _ := cmd.Flags().GetInt("max-downloads-per-ip")
+	clientBandwidth, _ := cmd.Flags().GetString("audio-bandwidth-per-ip")
+	totalBandwidth, _ := cmd.Flags().GetString("audio-bandwidth")
+
+	if requestRate < 0 || requestBurst < 1 || maxDownloads < 0 {
+		return nil, fmt.Errorf("rate limits can't be negative and the burst must be at least 1")
+	}
+
+	limits := &abuseLimits{
+		requestRate:  rate.Limit(requestRate),
+		requestBurst: requestBurst,
+		maxDownloads: maxDownloads,
+		clients:      make(map[string]*clientLimits),
+	}
+
+	perClient, err := parseByteRate(clientBandwidth)
+	if err != nil {
+		return nil, err
+	}
+	limits.clientBytes = rate.Limit(perClient)
+
+	total, err := parseByteRate(totalBandwidth)
+	if err != nil {
+		return nil, err
+	}
+	if total > 0 {
+		limits.totalBandwidth = rate.NewLimiter(rate.Limit(total), throttleChunk)
+	}
+	return limits, nil
+}
+
+// parseByteRate parses a bandwidth like 512K, 2M or 1.5MB (per second; powers of 1024).
+// An empty value or 0 means unlimited.
+func parseByteRate(value string) (float64, error) {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	if s == "" {
+		return 0, nil
+	}
+
+	multiplier := 1.0
+	switch s[len(s)-1] {
+	case 'K':
+		multiplier = 1 << 10
+	case 'M':
+		multiplier = 1 << 20
+	case 'G':
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid bandwidth '%s', use a value like 512K or 2M", value)
+	}
+	return n * multiplier, nil
+}
+
+// client returns the state of a client address, forgetting idle clients now and then
+func (l *abuseLimits) client(ip string) *clientLimits {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > time.Minute {
+		l.lastSweep = now
+		for key, c := range l.clients {
+			if c.downloads == 0 && now.Sub(c.lastSeen) > clientIdleTimeout {
+				delete(l.clients, key)
+			}
+		}
+	}
+
+	c, exists := l.clients[ip]
+	if !exists {
+		c = &clientLimits{requests: rate.NewLimiter(l.requestRate, l.requestBurst)}
+		if l.clientBytes > 0 {
+			c.bandwidth = rate.NewLimiter(l.clientBytes, throttleChunk)
+		}
+		l.clients[ip] = c
+	}
+	c.lastSeen = now
+	return c
+}
+
+// limitRequests answers 429 to clients sending requests faster than the per-IP rate
+func (l *abuseLimits) limitRequests(next http.Handler) http.Handler {
+	if l.requestRate == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reservation := l.client(remoteHost(r)).requests.Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+			tooManyRequests(w, delay, "request_rate")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitDownloads caps the downloads a client can have open at once and throttles the
+// bandwidth they use
+func (l *abuseLimits) limitDownloads(next http.Handler) http.Handler {
+	if l.maxDownloads == 0 && l.clientBytes == 0 && l.totalBandwidth == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := l.client(remoteHost(r))
+
+		l.mu.Lock()
+		if l.maxDownloads > 0 && c.downloads >= l.maxDownloads {
+			l.mu.Unlock()
+			tooManyRequests(w, downloadRetryAfter, "concurrent_downloads")
+			return
+		}
+		c.downloads++
+		l.mu.Unlock()
+
+		defer func() {
+			l.mu.Lock()
+			c.downloads--
+			c.lastSeen = time.Now()
+			l.mu.Unlock()
+		}()
+
+		if c.bandwidth != nil || l.totalBandwidth != nil {
+			w = &throttledWriter{ResponseWriter: w, r: r, limiters: []*rate.Limiter{c.bandwidth, l.totalBandwidth}}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tooManyRequests answers 429 with the number of seconds to wait in Retry-After
+func tooManyRequests(w http.ResponseWriter, retryAfter time.Duration, reason string) {
+	rateLimited.WithLabelValues(reason).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, "Too many requests, slow down", http.StatusTooManyRequests)
+}
+
+// throttledWriter writes a response no faster than its limiters allow
+type throttledWriter struct {
+	http.ResponseWriter
+	r        *http.Request
+	limiters []*rate.Limiter
+}
+
+func (tw *throttledWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > throttleChunk {
+			chunk = chunk[:throttleChunk]
+		}
+		for _, limiter := range tw.limiters {
+			if limiter == nil {
+				continue
+			}
+			if err := limiter.WaitN(tw.r.Context(), len(chunk)); err != nil {
+				return written, err // Client went away
+			}
+		}
+
+		n, err := tw.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[len(chunk):]
+	}
+	return written, nil
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (tw *throttledWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
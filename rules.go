@@ -0,0 +1,380 @@
+// rules.go
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	xhtml "golang.org/x/net/html"
+)
+
+// Rule filters or rewrites the items of a feed before it is rendered.
+// Rules run in order, each one seeing the output of the previous one.
+type Rule struct {
+	Action  string   `json:"action"`            // include, exclude, rewrite-host, strip-params or truncate
+	Field   string   `json:"field,omitempty"`   // include/exclude: title, content, link or category
+	Pattern string   `json:"pattern,omitempty"` // include/exclude: regular expression
+	From    string   `json:"from,omitempty"`    // rewrite-host: host to replace
+	To      string   `json:"to,omitempty"`      // rewrite-host: replacement host
+	Params  []string `json:"params,omitempty"`  // strip-params: query parameters, a trailing * matches a prefix
+	Length  int      `json:"length,omitempty"`  // truncate: maximum content length in characters
+
+	pattern *regexp.Regexp // Compiled Pattern of include/exclude rules, set by compile
+}
+
+// Rule actions
+const (
+	ruleInclude     = "include"
+	ruleExclude     = "exclude"
+	ruleRewriteHost = "rewrite-host"
+	ruleStripParams = "strip-params"
+	ruleTruncate    = "truncate"
+)
+
+// Query parameters removed by strip-params when none are configured
+var defaultTrackingParams = []string{"utm_*", "fbclid", "gclid", "dclid", "msclkid", "mc_cid", "mc_eid", "_hsenc", "_hsmi", "igshid", "yclid"}
+
+// validate checks that a rule has everything its action needs
+func (rule Rule) validate() error {
+	switch rule.Action {
+	case ruleInclude, ruleExclude:
+		switch rule.Field {
+		case "title", "content", "link", "category":
+		default:
+			return fmt.Errorf("field must be one of title, content, link or category")
+		}
+		if rule.Pattern == "" {
+			return fmt.Errorf("%s rules need a pattern", rule.Action)
+		}
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %v", err)
+		}
+	case ruleRewriteHost:
+		if rule.From == "" || rule.To == "" {
+			return fmt.Errorf("rewrite-host rules need --from and --to hosts")
+		}
+	case ruleStripParams:
+	case ruleTruncate:
+		if rule.Length <= 0 {
+			return fmt.Errorf("truncate rules need a positive --length")
+		}
+	default:
+		return fmt.Errorf("unknown action '%s'", rule.Action)
+	}
+	return nil
+}
+
+// compile prepares the pattern of a filter rule once, instead of on every render
+func (rule *Rule) compile() {
+	if rule.Action == ruleInclude || rule.Action == ruleExclude {
+		rule.pattern, _ = regexp.Compile(rule.Pattern)
+	}
+}
+
+// compileRules compiles the patterns of a feed's rules, as they are loaded
+func compileRules(rules []Rule) {
+	for i := range rules {
+		rules[i].compile()
+	}
+}
+
+// String describes a rule for listings
+func (rule Rule) String() string {
+	switch rule.Action {
+	case ruleInclude, ruleExclude:
+		return fmt.Sprintf("%s items whose %s matches /%s/", rule.Action, rule.Field, rule.Pattern)
+	case ruleRewriteHost:
+		return fmt.Sprintf("rewrite link host %s to %s", rule.From, rule.To)
+	case ruleStripParams:
+		params := rule.Params
+		if len(params) == 0 {
+			params = defaultTrackingParams
+		}
+		return fmt.Sprintf("strip query parameters %s", strings.Join(params, ", "))
+	case ruleTruncate:
+		return fmt.Sprintf("truncate content to %d characters", rule.Length)
+	}
+	return rule.Action
+}
+
+// applyRules runs a feed's rules over its items. When matched is non-nil it is called
+// for every item a rule matched (filters) or changed (rewrites), for test-rules.
+func applyRules(rules []Rule, items []Item, matched func(rule int, item Item)) []Item {
+	if len(rules) == 0 {
+		return items
+	}
+
+	result := make([]Item, len(items))
+	copy(result, items)
+
+	for i, rule := range rules {
+		pattern := rule.pattern
+		if pattern == nil && (rule.Action == ruleInclude || rule.Action == ruleExclude) {
+			continue // Invalid patterns are rejected by validate, only reachable with a hand-edited config
+		}
+
+		kept := result[:0]
+		for _, item := range result {
+			switch rule.Action {
+			case ruleInclude, ruleExclude:
+				isMatch := ruleFieldMatches(pattern, rule.Field, item)
+				if isMatch && matched != nil {
+					matched(i, item)
+				}
+				if isMatch != (rule.Action == ruleInclude) {
+					continue
+				}
+			default:
+				rewritten := applyRewrite(rule, item)
+				changed := rewritten.Link != item.Link || rewritten.Content != item.Content ||
+					rewritten.Description != item.Description
+				if changed && matched != nil {
+					matched(i, item)
+				}
+				item = rewritten
+			}
+			kept = append(kept, item)
+		}
+		result = kept
+	}
+
+	return result
+}
+
+// ruleFieldMatches reports whether the pattern matches the given field of an item
+func ruleFieldMatches(pattern *regexp.Regexp, field string, item Item) bool {
+	switch field {
+	case "title":
+		return pattern.MatchString(item.Title)
+	case "content":
+		return pattern.MatchString(item.Content) || pattern.MatchString(item.Description)
+	case "link":
+		return pattern.MatchString(item.Link)
+	case "category":
+		for _, category := range item.Categories {
+			if pattern.MatchString(category) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyRewrite applies a rewrite-host, strip-params or truncate rule to an item
+func applyRewrite(rule Rule, item Item) Item {
+	switch rule.Action {
+	case ruleRewriteHost:
+		if u, err := url.Parse(item.Link); err == nil && strings.EqualFold(u.Host, rule.From) {
+			u.Host = rule.To
+			item.Link = u.String()
+		}
+	case ruleStripParams:
+		params := rule.Params
+		if len(params) == 0 {
+			params = defaultTrackingParams
+		}
+		item.Link = stripQueryParams(item.Link, params)
+	case ruleTruncate:
+		item.Content = truncateHTML(item.Content, rule.Length)
+		item.Description = truncateHTML(item.Description, rule.Length)
+	}
+	return item
+}
+
+// stripQueryParams removes the named query parameters from a URL
+func stripQueryParams(link string, params []string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.RawQuery == "" {
+		return link
+	}
+
+	query := u.Query()
+	removed := false
+	for key := range query {
+		for _, param := range params {
+			prefix, isPrefix := strings.CutSuffix(param, "*")
+			if key == param || (isPrefix && strings.HasPrefix(key, prefix)) {
+				query.Del(key)
+				removed = true
+				break
+			}
+		}
+	}
+	if !removed {
+		return link
+	}
+
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// truncateText shortens text to at most length characters, marking the cut with an ellipsis
+func truncateText(text string, length int) string {
+	if utf8.RuneCountInString(text) <= length {
+		return text
+	}
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:length])) + "…"
+}
+
+// truncateHTML shortens the text of HTML content to at most length characters. Markup
+// doesn't count towards the length, cuts never land inside a tag or entity, and elements
+// left open at the cut are closed. Plain text is truncated as it is.
+func truncateHTML(content string, length int) string {
+	if !looksLikeHTML(content) {
+		return truncateText(content, length)
+	}
+
+	var b strings.Builder
+	var open []string
+	remaining := length
+
+	tokenizer := xhtml.NewTokenizer(strings.NewReader(content))
+	for {
+		tt := tokenizer.Next()
+		if tt == xhtml.ErrorToken {
+			return content // The text fits
+		}
+		token := tokenizer.Token()
+
+		switch tt {
+		case xhtml.TextToken:
+			if n := utf8.RuneCountInString(token.Data); n > remaining {
+				b.WriteString(html.EscapeString(truncateText(token.Data, remaining)))
+				for i := len(open) - 1; i >= 0; i-- {
+					b.WriteString("</" + open[i] + ">")
+				}
+				return b.String()
+			}
+			remaining -= utf8.RuneCountInString(token.Data)
+		case xhtml.StartTagToken:
+			if !voidElement(token.Data) {
+				open = append(open, token.Data)
+			}
+		case xhtml.EndTagToken:
+			if i := slices.Index(open, token.Data); i >= 0 {
+				open = open[:i]
+			}
+		}
+		b.WriteString(token.String())
+	}
+}
+
+// addRule appends a rule to a feed
+func addRule(cmd *cobra.Command, args []string) {
+	feedName, _ := cmd.Flags().GetString("feed")
+	rule := Rule{}
+	rule.Action, _ = cmd.Flags().GetString("action")
+	rule.Field, _ = cmd.Flags().GetString("field")
+	rule.Pattern, _ = cmd.Flags().GetString("pattern")
+	rule.From, _ = cmd.Flags().GetString("from")
+	rule.To, _ = cmd.Flags().GetString("to")
+	rule.Params, _ = cmd.Flags().GetStringSlice("params")
+	rule.Length, _ = cmd.Flags().GetInt("length")
+
+	feed, exists := config.Feeds[feedName]
+	if !exists {
+		fmt.Printf("Feed '%s' does not exist\n", feedName)
+		return
+	}
+
+	if err := rule.validate(); err != nil {
+		fmt.Printf("Invalid rule: %v\n", err)
+		return
+	}
+
+	if rule.Action != ruleInclude && rule.Action != ruleExclude {
+		rule.Field = "" // Defaults to title, only meaningful for filters
+	}
+	rule.compile()
+
+	feed.Rules = append(feed.Rules, rule)
+	config.Feeds[feedName] = feed
+
+	saveConfig()
+	fmt.Printf("Rule [%d] added to feed '%s': %s\n", len(feed.Rules)-1, feedName, rule)
+}
+
+// listRules lists the rules of a feed in the order they run
+func listRules(cmd *cobra.Command, args []string) {
+	feedName, _ := cmd.Flags().GetString("feed")
+
+	feed, exists := config.Feeds[feedName]
+	if !exists {
+		fmt.Printf("Feed '%s' does not exist\n", feedName)
+		return
+	}
+
+	if len(feed.Rules) == 0 {
+		fmt.Printf("No rules in feed '%s'\n", feedName)
+		return
+	}
+
+	fmt.Printf("Rules in feed '%s':\n", feedName)
+	for i, rule := range feed.Rules {
+		fmt.Printf("[%d] %s\n", i, rule)
+	}
+}
+
+// deleteRule removes a rule from a feed
+func deleteRule(cmd *cobra.Command, args []string) {
+	feedName, _ := cmd.Flags().GetString("feed")
+	index, _ := cmd.Flags().GetInt("index")
+
+	feed, exists := config.Feeds[feedName]
+	if !exists {
+		fmt.Printf("Feed '%s' does not exist\n", feedName)
+		return
+	}
+
+	if index < 0 || index >= len(feed.Rules) {
+		fmt.Printf("Invalid rule index: %d. Valid range: 0-%d\n", index, len(feed.Rules)-1)
+		return
+	}
+
+	feed.Rules = append(feed.Rules[:index], feed.Rules[index+1:]...)
+	config.Feeds[feedName] = feed
+
+	saveConfig()
+	fmt.Printf("Rule at index %d deleted from feed '%s'\n", index, feedName)
+}
+
+// testRules shows which items each rule of a feed matches, without changing anything
+func testRules(cmd *cobra.Command, args []string) {
+	feedName, _ := cmd.Flags().GetString("feed")
+
+	feed, exists := config.Feeds[feedName]
+	if !exists {
+		fmt.Printf("Feed '%s' does not exist\n", feedName)
+		return
+	}
+
+	if len(feed.Rules) == 0 {
+		fmt.Printf("No rules in feed '%s'\n", feedName)
+		return
+	}
+
+	input := feed.Items
+	if feed.Composite != nil {
+		input = mergedCompositeItems(feed)
+	}
+
+	matches := make([][]Item, len(feed.Rules))
+	result := applyRules(feed.Rules, input, func(rule int, item Item) {
+		matches[rule] = append(matches[rule], item)
+	})
+
+	for i, rule := range feed.Rules {
+		fmt.Printf("[%d] %s: %d items\n", i, rule, len(matches[i]))
+		for _, item := range matches[i] {
+			fmt.Printf("    - %s (%s)\n", item.Title, item.Link)
+		}
+	}
+	fmt.Printf("%d of %d items kept\n", len(result), len(input))
+}
@@ -0,0 +1,34 @@
+// rules_test.go
+package main
+
+import "testing"
+
+func TestTruncateHTML(t *testing.T) {
+	tests := []struct {
+		content string
+		length  int
+		want    string
+	}{
+		{"Plain text that is long", 10, "Plain text…"},
+		{"<p>Short</p>", 10, "<p>Short</p>"},
+		{`<p>Fish &amp; <a href="https://example.com/?a=1&amp;b=2">chips</a> and more</p>`, 9, `<p>Fish &amp; <a href="https://example.com/?a=1&amp;b=2">ch…</a></p>`},
+		{"<p><b>Bold</b></p><p>Second paragraph</p>", 6, "<p><b>Bold</b></p><p>Se…</p>"},
+		{"<p>One<br>Two three</p>", 6, "<p>One<br>Two…</p>"},
+	}
+	for _, test := range tests {
+		if got := truncateHTML(test.content, test.length); got != test.want {
+			t.Errorf("truncateHTML(%q, %d) = %q, want %q", test.content, test.length, got, test.want)
+		}
+	}
+}
+
+func TestApplyRulesUsesCompiledPatterns(t *testing.T) {
+	rules := []Rule{{Action: ruleExclude, Field: "title", Pattern: "(?i)sponsored"}, {Action: ruleInclude, Field: "title", Pattern: "("}}
+	items := []Item{{Title: "News"}, {Title: "Sponsored post"}}
+
+	compileRules(rules)
+	got := applyRules(rules, items, nil)
+	if len(got) != 1 || got[0].Title != "News" {
+		t.Errorf("applyRules kept %v, want only the News item and the invalid rule skipped", got)
+	}
+}
@@ -0,0 +1,176 @@
+// sanitize.go
+package main
+
+import (
+	"html"
+	"html/template"
+	"net/url"
+	"slices"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// Elements kept when item content is rendered on feed pages, with the attributes each may carry
+var allowedContentTags = map[string][]string{
+	"a": {"href", "title"}, "abbr": {"title"}, "b": nil, "blockquote": nil, "br": nil,
+	"code": nil, "dd": nil, "del": nil, "dl": nil, "dt": nil, "em": nil, "figcaption": nil,
+	"figure": nil, "h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil, "hr": nil,
+	"i": nil, "img": {"src", "alt", "title", "width", "height"}, "li": nil, "ol": nil,
+	"p": nil, "pre": nil, "q": nil, "s": nil, "small": nil, "span": nil, "strong": nil,
+	"sub": nil, "sup": nil, "table": nil, "tbody": nil, "td": nil, "th": nil, "thead": nil,
+	"tr": nil, "u": nil, "ul": nil,
+}
+
+// Elements dropped together with everything inside them
+var droppedContentTags = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true, "embed": true,
+	"noscript": true, "template": true, "svg": true, "math": true, "form": true,
+}
+
+// renderContent turns item content into HTML that is safe to embed in a page. HTML is
+// reduced to an allowlist of formatting elements; plain text keeps its paragraphs and
+// line breaks.
+func renderContent(content string) template.HTML {
+	if !looksLikeHTML(content) {
+		return plainTextHTML(content)
+	}
+	return sanitizeHTML(content)
+}
+
+// looksLikeHTML reports whether content contains HTML elements, rather than plain text
+// that happens to use angle brackets
+func looksLikeHTML(content string) bool {
+	if !strings.Contains(content, "<") {
+		return false
+	}
+	tokenizer := xhtml.NewTokenizer(strings.NewReader(content))
+	for {
+		switch tokenizer.Next() {
+		case xhtml.ErrorToken:
+			return false
+		case xhtml.StartTagToken, xhtml.EndTagToken, xhtml.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			tag := string(name)
+			if _, allowed := allowedContentTags[tag]; allowed || droppedContentTags[tag] || tag == "div" {
+				return true
+			}
+		}
+	}
+}
+
+// plainTextHTML escapes plain text, turning blank lines into paragraphs
+func plainTextHTML(text string) template.HTML {
+	var b strings.Builder
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.ReplaceAll(html.EscapeString(paragraph), "\n", "<br>"))
+		b.WriteString("</p>")
+	}
+	return template.HTML(b.String())
+}
+
+// sanitizeHTML keeps the allowed elements and attributes of an HTML fragment, drops
+// scripts and other active content, and closes elements left open
+func sanitizeHTML(fragment string) template.HTML {
+	var b strings.Builder
+	var open []string
+	skipping := ""
+	depth := 0
+
+	tokenizer := xhtml.NewTokenizer(strings.NewReader(fragment))
+	for {
+		tt := tokenizer.Next()
+		if tt == xhtml.ErrorToken {
+			break
+		}
+		token := tokenizer.Token()
+
+		if skipping != "" {
+			switch {
+			case tt == xhtml.StartTagToken && token.Data == skipping:
+				depth++
+			case tt == xhtml.EndTagToken && token.Data == skipping:
+				depth--
+				if depth == 0 {
+					skipping = ""
+				}
+			}
+			continue
+		}
+
+		switch tt {
+		case xhtml.TextToken:
+			b.WriteString(html.EscapeString(token.Data))
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			if droppedContentTags[token.Data] {
+				if tt == xhtml.StartTagToken {
+					skipping, depth = token.Data, 1
+				}
+				continue
+			}
+			attrs, allowed := allowedContentTags[token.Data]
+			if !allowed {
+				continue
+			}
+			b.WriteString("<" + token.Data)
+			for _, attr := range token.Attr {
+				if !slices.Contains(attrs, attr.Key) {
+					continue
+				}
+				if (attr.Key == "href" || attr.Key == "src") && !safeContentURL(attr.Val) {
+					continue
+				}
+				b.WriteString(" " + attr.Key + `="` + html.EscapeString(attr.Val) + `"`)
+			}
+			if token.Data == "a" {
+				b.WriteString(` rel="nofollow noopener" target="_blank"`)
+			}
+			b.WriteString(">")
+			if tt == xhtml.StartTagToken && !voidElement(token.Data) {
+				open = append(open, token.Data)
+			}
+		case xhtml.EndTagToken:
+			// Only close elements that are open, along with any left open inside them
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != token.Data {
+					continue
+				}
+				for len(open) > i {
+					b.WriteString("</" + open[len(open)-1] + ">")
+					open = open[:len(open)-1]
+				}
+				break
+			}
+		}
+	}
+
+	for len(open) > 0 {
+		b.WriteString("</" + open[len(open)-1] + ">")
+		open = open[:len(open)-1]
+	}
+	return template.HTML(b.String())
+}
+
+// safeContentURL reports whether a link or image URL in item content is safe to keep:
+// relative, or http, https or mailto
+func safeContentURL(value string) bool {
+	u, err := url.Parse(strings.TrimSpace(value))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// voidElement reports whether an element has no end tag
+func voidElement(tag string) bool {
+	return tag == "br" || tag == "hr" || tag == "img"
+}
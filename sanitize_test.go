@@ -0,0 +1,53 @@
+// sanitize_test.go
+package main
+
+import "testing"
+
+func TestSanitizeHTML(t *testing.T) {
+	const link = ` rel="nofollow noopener" target="_blank"`
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"formatting kept", `<p>Some <b>bold</b> and <em>emphasis</em></p>`, `<p>Some <b>bold</b> and <em>emphasis</em></p>`},
+		{"script dropped with its content", `<p>Hi<script>alert(1)</script> there</p>`, `<p>Hi there</p>`},
+		{"upper-case style dropped", `<STYLE>body{display:none}</STYLE><p>x</p>`, `<p>x</p>`},
+		{"iframe dropped with its content", `<iframe src="https://evil.example"><p>in</p></iframe><p>out</p>`, `<p>out</p>`},
+		{"nested svg dropped", `<svg><svg><script>alert(1)</script></svg></svg><p>after</p>`, `<p>after</p>`},
+		{"unclosed script drops the rest", `<p>before</p><script>alert(1)`, `<p>before</p>`},
+		{"self-closing script", `<script/><p>after</p>`, `&lt;p&gt;after&lt;/p&gt;`},
+		{"tag split by a script", `<scr<script>ipt>alert(1)</script>`, `ipt&gt;alert(1)`},
+		{"event handlers dropped", `<img src="/a.png" onerror="alert(1)" ONLOAD="alert(2)">`, `<img src="/a.png">`},
+		{"unknown attributes dropped", `<p style="color:red" class="x">z</p>`, `<p>z</p>`},
+		{"javascript URL", `<a href="javascript:alert(1)">x</a>`, `<a` + link + `>x</a>`},
+		{"mixed-case javascript URL", `<a href="JaVaScRiPt:alert(1)">x</a>`, `<a` + link + `>x</a>`},
+		{"javascript URL with leading space", `<a href=" javascript:alert(1)">x</a>`, `<a` + link + `>x</a>`},
+		{"entity-encoded javascript URL", `<a href="&#106;avascript:alert(1)">x</a>`, `<a` + link + `>x</a>`},
+		{"javascript URL split by a tab", `<a href="java&#09;script:alert(1)">x</a>`, `<a` + link + `>x</a>`},
+		{"vbscript URL", `<a href="vbscript:msgbox(1)">x</a>`, `<a` + link + `>x</a>`},
+		{"data URL image", `<img src="data:image/svg+xml;base64,PHN2Zz4=">`, `<img>`},
+		{"safe URLs kept", `<a href="https://example.com/?a=1&amp;b=2">x</a> <a href="mailto:a@example.com">m</a>`, `<a href="https://example.com/?a=1&amp;b=2"` + link + `>x</a> <a href="mailto:a@example.com"` + link + `>m</a>`},
+		{"attribute breaking out", `<a href="/x" title='"><script>alert(1)</script>'>y</a>`, `<a href="/x" title="&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;"` + link + `>y</a>`},
+		{"escaped markup stays text", `&lt;script&gt;alert(1)&lt;/script&gt;`, `&lt;script&gt;alert(1)&lt;/script&gt;`},
+		{"raw text element content escaped", `<textarea><img src=x onerror=alert(1)></textarea>`, `&lt;img src=x onerror=alert(1)&gt;`},
+		{"unclosed tags closed", `<p>bold <b>text`, `<p>bold <b>text</b></p>`},
+		{"stray end tags ignored", `</b><p>x</p></p></div>`, `<p>x</p>`},
+		{"disallowed element unwrapped", `<div><b>x</div>`, `<b>x</b>`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(sanitizeHTML(test.input)); got != test.want {
+				t.Errorf("sanitizeHTML(%q)\n got %s\nwant %s", test.input, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRenderContentPlainText(t *testing.T) {
+	got := string(renderContent("1 < 2 & 3 > 2\nsecond line\n\n<not a tag>"))
+	want := `<p>1 &lt; 2 &amp; 3 &gt; 2<br>second line</p><p>&lt;not a tag&gt;</p>`
+	if got != want {
+		t.Errorf("renderContent = %s, want %s", got, want)
+	}
+}
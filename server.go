@@ -0,0 +1,111 @@
+// server.go
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Default server timeouts, overridable with serve flags
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = time.Minute
+	defaultIdleTimeout       = 2 * time.Minute
+	defaultShutdownTimeout   = 30 * time.Second
+)
+
+// newHTTPServer builds the server for serve, with the timeouts from its flags.
+// The write timeout defaults to none so long audio downloads aren't cut off.
+func newHTTPServer(cmd *cobra.Command, handler http.Handler) *http.Server {
+	readHeaderTimeout, _ := cmd.Flags().GetDuration("read-header-timeout")
+	readTimeout, _ := cmd.Flags().GetDuration("read-timeout")
+	writeTimeout, _ := cmd.Flags().GetDuration("write-timeout")
+	idleTimeout, _ := cmd.Flags().GetDuration("idle-timeout")
+
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+// binding is a listener and the server that handles its connections
+type binding struct {
+	server   *http.Server
+	listener net.Listener
+}
+
+// runServers serves every binding until ctx is done, then stops accepting connections and
+// gives open requests the grace period to finish before closing them. Servers with a TLS
+// config serve HTTPS. It returns the end of the grace period, so the caller can spend what
+// is left of it on cleanup.
+func runServers(ctx context.Context, grace time.Duration, bindings ...binding) (time.Time, error) {
+	// Decide up front: Serve fills in an empty TLSConfig for HTTP/2 on servers without one
+	useTLS := make([]bool, len(bindings))
+	for i, b := range bindings {
+		useTLS[i] = b.server.TLSConfig != nil
+	}
+
+	errs := make(chan error, len(bindings))
+	for i, b := range bindings {
+		go func(b binding, useTLS bool) {
+			if useTLS {
+				errs <- b.server.ServeTLS(b.listener, "", "")
+				return
+			}
+			errs <- b.server.Serve(b.listener)
+		}(b, useTLS[i])
+	}
+
+	select {
+	case err := <-errs:
+		return time.Time{}, err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down, waiting for open requests", "grace", grace)
+	deadline := time.Now().Add(grace)
+	shutdownCtx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	stopped := make(map[*http.Server]bool)
+	for _, b := range bindings {
+		if stopped[b.server] {
+			continue
+		}
+		stopped[b.server] = true
+		if err := b.server.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("Grace period expired, closing remaining connections", "error", err)
+			b.server.Close()
+		}
+	}
+	for range bindings {
+		if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+			return deadline, err
+		}
+	}
+	return deadline, nil
+}
+
+// flushState finishes the server's background work before exit. The access log is
+// closed and webhook and WebSub deliveries get whatever is left of the grace period, with
+// unfinished webhook deliveries queued for the next start; config and log writes aren't
+// buffered, so nothing else needs saving.
+func flushState(deadline time.Time, accessLog *accessLogger) {
+	if err := accessLog.Close(); err != nil {
+		slog.Error("Failed to close access log", "error", err)
+	}
+
+	if !waitForWebhooksTimeout(time.Until(deadline)) {
+		slog.Warn("Abandoning webhook and WebSub deliveries still in flight", "queuedWebhooks", queueUnfinishedDeliveries())
+	}
+}
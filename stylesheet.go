@@ -0,0 +1,22 @@
+// stylesheet.go
+package main
+
+import "strings"
+
+// feedStylesheetURL is the stylesheet serve links feeds to with --feed-stylesheet, "" for none
+var feedStylesheetURL string
+
+// addStylesheet links an RSS document to an XSL stylesheet, so browsers render it as a page
+// instead of raw XML. Feed readers ignore the instruction.
+func addStylesheet(rss, href string) string {
+	if href == "" {
+		return rss
+	}
+	instruction := `<?xml-stylesheet type="text/xsl" href="` + href + `"?>`
+	if strings.HasPrefix(rss, "<?xml") {
+		if end := strings.Index(rss, "?>"); end >= 0 {
+			return rss[:end+2] + "\n" + instruction + "\n" + strings.TrimLeft(rss[end+2:], "\n")
+		}
+	}
+	return instruction + "\n" + rss
+}
@@ -0,0 +1,340 @@
+// theme.go
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed themes/default
+var embeddedThemes embed.FS
+
+// Files a theme is made of. Any other file in a theme directory, like fonts or images,
+// is served under /theme/ as well.
+const (
+	themeHomeTemplate   = "home.html"
+	themeFeedTemplate   = "feed.html"
+	themeStylesheet     = "style.css"
+	themeFeedStylesheet = "feed.css"
+	themeFeedXSL        = "feed.xsl"
+	themeLogo           = "logo.png"
+	themeFavicon        = "favicon.ico"
+	themeSettingsFile   = "theme.json"
+)
+
+// Route the files of the theme are served under
+const themeAssetPath = "/theme/"
+
+// Cache-Control of asset URLs carrying a content hash, which never change
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// Logo files picked up from a theme directory, in order of preference
+var themeLogoFiles = []string{"logo.svg", "logo.png", "logo.jpg", "logo.webp"}
+
+// Content types of theme files Go doesn't know or gets wrong
+var themeContentTypes = map[string]string{
+	".xsl": "text/xsl; charset=utf-8",
+	".ico": "image/x-icon",
+}
+
+// ThemeSettings are the site details a theme directory can set in theme.json
+type ThemeSettings struct {
+	SiteTitle string `json:"siteTitle,omitempty"`
+	Tagline   string `json:"tagline,omitempty"`
+	Logo      string `json:"logo,omitempty"` // URL of the logo image
+}
+
+// HomePage is the data the homepage template is rendered with
+type HomePage struct {
+	SiteTitle     string
+	Tagline       string
+	LogoURL       string
+	StylesheetURL string
+	FeedCount     int
+	PodcastCount  int
+	Feeds         []HomeFeed
+	Podcasts      []HomeFeed
+}
+
+// HomeFeed is a public feed or podcast listed on the homepage
+type HomeFeed struct {
+	Name        string
+	Title       string
+	Description string
+	FeedURL     string // RSS document
+	PageURL     string // HTML page
+	ImageURL    string
+	Count       int // Items or episodes
+}
+
+// siteTheme holds the templates and assets serve uses: the files of a theme directory,
+// falling back to the default theme embedded in the binary for any it doesn't have.
+// Everything is read once at startup.
+type siteTheme struct {
+	settings ThemeSettings
+	home     *template.Template
+	feed     *template.Template
+	assets   map[string]*themeAsset // By name and by content-hashed name
+}
+
+// themeAsset is a static file of a theme
+type themeAsset struct {
+	name       string
+	hashedName string // e.g. style.3f9a0c1b2d.css
+	hash       string
+	data       []byte
+	modTime    time.Time
+}
+
+// themeDir returns the default theme directory, next to the config file
+func themeDir() string {
+	return filepath.Join(filepath.Dir(cfgFile), "theme")
+}
+
+// loadTheme loads the theme for serve. An empty dir uses the theme directory next to the
+// config file when there is one, and the embedded default theme otherwise.
+func loadTheme(dir string) (*siteTheme, error) {
+	if dir == "" {
+		if info, err := os.Stat(themeDir()); err == nil && info.IsDir() {
+			dir = themeDir()
+		}
+	} else if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("theme directory %s does not exist", dir)
+	}
+
+	defaultTheme, _ := fs.Sub(embeddedThemes, "themes/default")
+	files, err := readThemeFiles(defaultTheme)
+	if err != nil {
+		return nil, err
+	}
+
+	theme := &siteTheme{
+		settings: ThemeSettings{
+			SiteTitle: "ChopChopRSS",
+			Tagline:   "Fast and simple RSS feeds and podcast hosting",
+		},
+		assets: make(map[string]*themeAsset),
+	}
+	logo := themeLogo
+
+	if dir != "" {
+		overrides, err := readThemeFiles(os.DirFS(dir))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read theme directory: %v", err)
+		}
+		for _, name := range themeLogoFiles {
+			if _, exists := overrides[name]; exists {
+				logo = name
+				break
+			}
+		}
+		if settings, exists := overrides[themeSettingsFile]; exists {
+			if err := json.Unmarshal(settings.data, &theme.settings); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %v", themeSettingsFile, err)
+			}
+		}
+		for name, file := range overrides {
+			files[name] = file
+		}
+		slog.Info("Using theme", "dir", dir)
+	}
+
+	for name, asset := range files {
+		if path.Ext(name) == ".html" || name == themeSettingsFile {
+			continue
+		}
+		theme.assets[name] = asset
+		theme.assets[asset.hashedName] = asset
+	}
+	if theme.settings.Logo == "" {
+		theme.settings.Logo = theme.assetURL(logo)
+	}
+
+	funcs := template.FuncMap{"asset": theme.assetURL}
+	for name, tmpl := range map[string]**template.Template{themeHomeTemplate: &theme.home, themeFeedTemplate: &theme.feed} {
+		source, exists := files[name]
+		if !exists {
+			return nil, fmt.Errorf("theme has no %s", name)
+		}
+		*tmpl, err = template.New(name).Funcs(funcs).Parse(string(source.data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid template %s: %v", name, err)
+		}
+	}
+	return theme, nil
+}
+
+// readThemeFiles reads every file of a theme, skipping hidden files and directories
+func readThemeFiles(fsys fs.FS) (map[string]*themeAsset, error) {
+	files := make(map[string]*themeAsset)
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name != "." && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		var modTime time.Time
+		if info, err := entry.Info(); err == nil {
+			modTime = info.ModTime()
+		}
+
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])[:10]
+		ext := path.Ext(name)
+		files[name] = &themeAsset{
+			name:       name,
+			hashedName: strings.TrimSuffix(name, ext) + "." + hash + ext,
+			hash:       hash,
+			data:       data,
+			modTime:    modTime,
+		}
+		return nil
+	})
+	return files, err
+}
+
+// assetURL returns the content-hashed URL of a theme file, which browsers can cache for good
+func (t *siteTheme) assetURL(name string) string {
+	if asset, exists := t.assets[name]; exists {
+		return themeAssetPath + asset.hashedName
+	}
+	return themeAssetPath + name
+}
+
+// homepageHandler serves the homepage, listing the public feeds and podcasts
+func (t *siteTheme) homepageHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only serve homepage on exact root path
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		configMu.RLock()
+		page := t.homePage()
+		configMu.RUnlock()
+
+		var buf bytes.Buffer
+		if err := t.home.Execute(&buf, page); err != nil {
+			slog.Error("Failed to render homepage", "error", err)
+			http.Error(w, "Failed to render page", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+}
+
+// homePage collects the homepage data. Private and access-restricted feeds and podcasts
+// are left off. Callers running inside the server must hold configMu.
+func (t *siteTheme) homePage() HomePage {
+	page := HomePage{
+		SiteTitle:     t.settings.SiteTitle,
+		Tagline:       t.settings.Tagline,
+		LogoURL:       t.settings.Logo,
+		StylesheetURL: t.assetURL(themeStylesheet),
+	}
+
+	for name, feed := range config.Feeds {
+		if restrictedFeed(feed) {
+			continue
+		}
+		page.Feeds = append(page.Feeds, HomeFeed{
+			Name:        name,
+			Title:       feed.Title,
+			Description: feed.Description,
+			FeedURL:     "/" + name,
+			PageURL:     "/" + name + "/",
+			Count:       len(renderedItems(feed)),
+		})
+	}
+
+	for name, podcast := range config.Podcasts {
+		if restrictedPodcast(podcast) {
+			continue
+		}
+		urlPath := podcastURLPath(name, podcast)
+		page.Podcasts = append(page.Podcasts, HomeFeed{
+			Name:        name,
+			Title:       podcast.Title,
+			Description: podcast.Description,
+			FeedURL:     urlPath,
+			PageURL:     urlPath + "/",
+			ImageURL:    podcast.ImageURL,
+			Count:       len(podcast.Episodes),
+		})
+	}
+
+	sort.Slice(page.Feeds, func(i, j int) bool { return page.Feeds[i].Name < page.Feeds[j].Name })
+	sort.Slice(page.Podcasts, func(i, j int) bool { return page.Podcasts[i].Name < page.Podcasts[j].Name })
+	page.FeedCount, page.PodcastCount = len(page.Feeds), len(page.Podcasts)
+	return page
+}
+
+// assetHandler serves the stylesheets, images and other files of the theme under /theme/.
+// Templates and theme.json aren't served.
+func (t *siteTheme) assetHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.serveAsset(w, r, strings.TrimPrefix(r.URL.Path, themeAssetPath))
+	})
+}
+
+// assetRoute serves one theme file at a fixed route, like /favicon.ico
+func (t *siteTheme) assetRoute(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.serveAsset(w, r, name)
+	})
+}
+
+// serveAsset serves a theme file
+func (t *siteTheme) serveAsset(w http.ResponseWriter, r *http.Request, name string) {
+	serveStaticAsset(w, r, t.assets, name)
+}
+
+// serveStaticAsset serves an embedded or theme file by name. Content-hashed names are
+// cached for a year; plain names are revalidated with their ETag, so edits show up after
+// a restart.
+func serveStaticAsset(w http.ResponseWriter, r *http.Request, assets map[string]*themeAsset, name string) {
+	asset, exists := assets[name]
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	if name == asset.hashedName {
+		w.Header().Set("Cache-Control", immutableCacheControl)
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("ETag", `"`+asset.hash+`"`)
+	if contentType, known := themeContentTypes[path.Ext(name)]; known {
+		w.Header().Set("Content-Type", contentType)
+	}
+	http.ServeContent(w, r, asset.name, asset.modTime, bytes.NewReader(asset.data))
+}
@@ -0,0 +1,144 @@
+<?xml version="1.0" encoding="UTF-8"?>
+<!--
+  Renders RSS feeds and podcasts opened in a browser as a page explaining how to subscribe.
+  The feed's URL isn't part of the document, so a small script fills it in. Only http(s)
+  links are followed, as feed content isn't trusted.
+-->
+<xsl:stylesheet version="1.0"
+    xmlns:xsl="http://www.w3.org/1999/XSL/Transform"
+    xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+  <xsl:output method="html" version="1.0" encoding="UTF-8" indent="yes"/>
+  <xsl:template match="/">
+    <html lang="en">
+      <head>
+        <meta charset="UTF-8"/>
+        <meta name="viewport" content="width=device-width, initial-scale=1.0"/>
+        <title><xsl:value-of select="/rss/channel/title"/> (feed)</title>
+        <style>
+          body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
+            line-height: 1.6;
+            color: #333;
+            max-width: 800px;
+            margin: 0 auto;
+            padding: 20px;
+            background-color: #f8f9fa;
+          }
+          .container {
+            background: white;
+            border-radius: 10px;
+            padding: 40px;
+            box-shadow: 0 2px 10px rgba(0,0,0,0.1);
+          }
+          .notice {
+            background: #ecf0f1;
+            border-radius: 8px;
+            padding: 15px 20px;
+            margin-bottom: 30px;
+          }
+          .notice code {
+            display: block;
+            background: white;
+            border-radius: 4px;
+            padding: 6px 10px;
+            margin: 10px 0;
+            word-break: break-all;
+          }
+          .header {
+            display: flex;
+            gap: 25px;
+            align-items: flex-start;
+          }
+          .artwork {
+            width: 120px;
+            height: 120px;
+            object-fit: cover;
+            border-radius: 8px;
+          }
+          h1 {
+            color: #2c3e50;
+            margin: 0 0 10px;
+          }
+          h2 {
+            color: #2c3e50;
+            font-size: 1.2em;
+            margin: 0 0 5px;
+          }
+          a {
+            color: #3498db;
+          }
+          .item {
+            padding: 20px 0;
+            border-top: 1px solid #ecf0f1;
+          }
+          .meta {
+            color: #7f8c8d;
+            font-size: 0.9em;
+          }
+          audio {
+            width: 100%;
+            margin-top: 10px;
+          }
+        </style>
+      </head>
+      <body>
+        <div class="container">
+          <div class="notice">
+            <strong>This is a web feed.</strong>
+            <xsl:choose>
+              <xsl:when test="/rss/channel/itunes:*">
+                Subscribe by copying this address into your podcast app:
+              </xsl:when>
+              <xsl:otherwise>
+                Subscribe by copying this address into your feed reader:
+              </xsl:otherwise>
+            </xsl:choose>
+            <code id="feed-url"></code>
+            New to feeds? They let you follow sites and shows without an account, and your
+            app checks for new posts for you. <a id="page-link" href="./">View this feed as a web page</a>.
+          </div>
+
+          <div class="header">
+            <xsl:variable name="image">
+              <xsl:choose>
+                <xsl:when test="/rss/channel/itunes:image/@href"><xsl:value-of select="/rss/channel/itunes:image/@href"/></xsl:when>
+                <xsl:otherwise><xsl:value-of select="/rss/channel/image/url"/></xsl:otherwise>
+              </xsl:choose>
+            </xsl:variable>
+            <xsl:if test="$image != ''">
+              <img class="artwork" src="{$image}" alt=""/>
+            </xsl:if>
+            <div>
+              <h1><xsl:value-of select="/rss/channel/title"/></h1>
+              <p><xsl:value-of select="/rss/channel/description"/></p>
+              <xsl:if test="starts-with(/rss/channel/link, 'http')">
+                <a href="{/rss/channel/link}"><xsl:value-of select="/rss/channel/link"/></a>
+              </xsl:if>
+            </div>
+          </div>
+
+          <xsl:for-each select="/rss/channel/item">
+            <div class="item">
+              <h2>
+                <xsl:choose>
+                  <xsl:when test="starts-with(link, 'http') and not(enclosure)">
+                    <a href="{link}"><xsl:value-of select="title"/></a>
+                  </xsl:when>
+                  <xsl:otherwise><xsl:value-of select="title"/></xsl:otherwise>
+                </xsl:choose>
+              </h2>
+              <div class="meta"><xsl:value-of select="pubDate"/></div>
+              <xsl:if test="starts-with(enclosure/@type, 'audio/')">
+                <audio controls="controls" preload="none" src="{enclosure/@url}"></audio>
+              </xsl:if>
+            </div>
+          </xsl:for-each>
+        </div>
+        <script>
+          document.getElementById('feed-url').textContent = location.href;
+          document.getElementById('page-link').href = location.pathname.replace(/\/*$/, '/') + location.search;
+        </script>
+      </body>
+    </html>
+  </xsl:template>
+</xsl:stylesheet>
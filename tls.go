@@ -0,0 +1,239 @@
+// tls.go
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Listen address of the HTTP-01 challenge and redirect server in ACME mode
+const defaultACMEHTTPListen = ":80"
+
+// acmeCacheDir returns the default directory ACME certificates and account keys are kept in
+func acmeCacheDir() string {
+	return filepath.Join(filepath.Dir(cfgFile), "acme")
+}
+
+// serverTLS returns the TLS config for serve's --tls-cert/--tls-key or --acme-domain flags,
+// nil when serving plain HTTP. In ACME mode it also returns the server that answers
+// HTTP-01 challenges and redirects everything else to HTTPS.
+func serverTLS(cmd *cobra.Command, httpsPort string) (*tls.Config, *http.Server, error) {
+	certFile, _ := cmd.Flags().GetString("tls-cert")
+	keyFile, _ := cmd.Flags().GetString("tls-key")
+	domains, _ := cmd.Flags().GetStringSlice("acme-domain")
+
+	switch {
+	case len(domains) > 0 && (certFile != "" || keyFile != ""):
+		return nil, nil, fmt.Errorf("use either --tls-cert/--tls-key or --acme-domain, not both")
+	case certFile != "" || keyFile != "":
+		if certFile == "" || keyFile == "" {
+			return nil, nil, fmt.Errorf("--tls-cert and --tls-key must be given together")
+		}
+		certs, err := newCertReloader(certFile, keyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.getCertificate}, nil, nil
+	case len(domains) > 0:
+		return acmeTLS(cmd, domains, httpsPort)
+	}
+	return nil, nil, nil
+}
+
+// acmeTLS sets up automatic certificates for the given domains
+func acmeTLS(cmd *cobra.Command, domains []string, httpsPort string) (*tls.Config, *http.Server, error) {
+	email, _ := cmd.Flags().GetString("acme-email")
+	cacheDir, _ := cmd.Flags().GetString("acme-cache")
+	directory, _ := cmd.Flags().GetString("acme-directory")
+	caCert, _ := cmd.Flags().GetString("acme-ca-cert")
+	httpListen, _ := cmd.Flags().GetString("acme-http-listen")
+
+	if cacheDir == "" {
+		cacheDir = acmeCacheDir()
+	}
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		return nil, nil, fmt.Errorf("failed to create ACME cache directory: %v", err)
+	}
+
+	transport := http.DefaultTransport
+	if caCert != "" {
+		// Test CAs like Pebble serve their directory with a certificate of their own
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read ACME CA certificate: %v", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("no certificates found in %s", caCert)
+		}
+		transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}
+	}
+	client := &acme.Client{
+		DirectoryURL: directory,
+		HTTPClient: &http.Client{
+			Timeout:   time.Minute,
+			Transport: &acmeOrderLocations{next: transport, orders: make(map[string]string)},
+		},
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cacheDir),
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Email:      email,
+		Client:     client,
+	}
+
+	challengeServer := &http.Server{
+		Addr:              httpListen,
+		Handler:           stripHostPort(manager.HTTPHandler(redirectToHTTPS(httpsPort))),
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+
+	tlsConfig := manager.TLSConfig()
+	tlsConfig.MinVersion = tls.VersionTLS12
+	slog.Info("Using ACME certificates", "domains", domains, "directory", client.DirectoryURL, "cache", cacheDir)
+	return tlsConfig, challengeServer, nil
+}
+
+// acmeOrderLocations fills in the order URL on finalize responses that don't name it. CAs
+// that issue asynchronously, like Pebble, answer a finalize request with a processing
+// order and no Location header, and the ACME client then has no URL to poll the order at.
+type acmeOrderLocations struct {
+	next http.RoundTripper
+
+	mu     sync.Mutex
+	orders map[string]string // Finalize URL to order URL
+}
+
+func (t *acmeOrderLocations) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || req.Method != http.MethodPost || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp, err
+	}
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		t.mu.Lock()
+		order, known := t.orders[req.URL.String()]
+		t.mu.Unlock()
+		if known {
+			resp.Header.Set("Location", order)
+		}
+		return resp, nil
+	}
+
+	// A new order is created at its Location and names the URL it is finalized at
+	if resp.StatusCode == http.StatusCreated {
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+
+		var order struct {
+			Finalize string `json:"finalize"`
+		}
+		if json.Unmarshal(body, &order) == nil && order.Finalize != "" {
+			t.mu.Lock()
+			t.orders[order.Finalize] = location
+			t.mu.Unlock()
+		}
+	}
+	return resp, nil
+}
+
+// stripHostPort removes the port from the Host header. autocert checks the host policy
+// against the raw header, which only works when challenges arrive on port 80.
+func stripHostPort(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if host, _, err := net.SplitHostPort(r.Host); err == nil {
+			r.Host = host
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL on the HTTPS port
+func redirectToHTTPS(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// certReloader serves a certificate from files and picks up renewals, e.g. by certbot,
+// without a restart
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// newCertReloader loads a certificate and key, failing early when they don't load
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// load reads the certificate and key files
+func (c *certReloader) load() error {
+	info, err := os.Stat(c.certFile)
+	if err != nil {
+		return fmt.Errorf("failed to read TLS certificate: %v", err)
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %v", err)
+	}
+	c.cert, c.modTime = &cert, info.ModTime()
+	return nil
+}
+
+// getCertificate returns the current certificate, reloading it when the file has changed.
+// The file is checked at most once a minute; a renewal that fails to load keeps the old
+// certificate in use.
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.checked) < time.Minute {
+		return c.cert, nil
+	}
+	c.checked = time.Now()
+
+	if info, err := os.Stat(c.certFile); err == nil && !info.ModTime().Equal(c.modTime) {
+		if err := c.load(); err != nil {
+			slog.Warn("Keeping previous TLS certificate", "error", err)
+		} else {
+			slog.Info("Reloaded TLS certificate", "path", c.certFile)
+		}
+	}
+	return c.cert, nil
+}
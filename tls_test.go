@@ -0,0 +1,260 @@
+// tls_test.go
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// newTLSCommand returns a command with serve's TLS flags, set to the given values
+func newTLSCommand(t *testing.T, flags map[string]string) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("tls-cert", "", "")
+	cmd.Flags().String("tls-key", "", "")
+	cmd.Flags().StringSlice("acme-domain", nil, "")
+	cmd.Flags().String("acme-email", "", "")
+	cmd.Flags().String("acme-cache", "", "")
+	cmd.Flags().String("acme-directory", "", "")
+	cmd.Flags().String("acme-ca-cert", "", "")
+	cmd.Flags().String("acme-http-listen", defaultACMEHTTPListen, "")
+	for name, value := range flags {
+		if err := cmd.Flags().Set(name, value); err != nil {
+			t.Fatalf("set --%s: %v", name, err)
+		}
+	}
+	return cmd
+}
+
+// writeSelfSignedCert writes a certificate and key for example.com and returns their paths
+func writeSelfSignedCert(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func TestServerTLSFlags(t *testing.T) {
+	certFile, keyFile := writeSelfSignedCert(t)
+
+	tests := []struct {
+		name    string
+		flags   map[string]string
+		wantErr string
+	}{
+		{"plain HTTP", nil, ""},
+		{"certificate files", map[string]string{"tls-cert": certFile, "tls-key": keyFile}, ""},
+		{"certificate without key", map[string]string{"tls-cert": certFile}, "must be given together"},
+		{"files and ACME", map[string]string{"tls-cert": certFile, "tls-key": keyFile, "acme-domain": "example.com"}, "not both"},
+		{"unreadable certificate", map[string]string{"tls-cert": certFile + ".missing", "tls-key": keyFile}, "failed to read TLS certificate"},
+		{"missing ACME CA certificate", map[string]string{"acme-domain": "example.com", "acme-cache": t.TempDir(), "acme-ca-cert": certFile + ".missing"}, "failed to read ACME CA certificate"},
+		{"empty ACME CA certificate", map[string]string{"acme-domain": "example.com", "acme-cache": t.TempDir(), "acme-ca-cert": keyFile}, "no certificates found"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tlsConfig, challengeServer, err := serverTLS(newTLSCommand(t, test.flags), "443")
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("serverTLS error = %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("serverTLS: %v", err)
+			}
+			if challengeServer != nil {
+				t.Error("challenge server started without ACME")
+			}
+			if test.flags == nil {
+				if tlsConfig != nil {
+					t.Error("TLS enabled without TLS flags")
+				}
+				return
+			}
+			cert, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+			if err != nil || cert == nil {
+				t.Fatalf("GetCertificate = %v, %v, want the certificate from the files", cert, err)
+			}
+		})
+	}
+}
+
+func TestACMEChallengeServerRedirects(t *testing.T) {
+	flags := map[string]string{"acme-domain": "example.com", "acme-cache": t.TempDir(), "acme-directory": "https://acme.invalid/directory"}
+	_, challengeServer, err := serverTLS(newTLSCommand(t, flags), "8443")
+	if err != nil {
+		t.Fatalf("serverTLS: %v", err)
+	}
+	if challengeServer == nil || challengeServer.Addr != defaultACMEHTTPListen {
+		t.Fatalf("challenge server = %v, want one listening on %s", challengeServer, defaultACMEHTTPListen)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com:8080/blog?page=2", nil)
+	rec := httptest.NewRecorder()
+	challengeServer.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "https://example.com:8443/blog?page=2" {
+		t.Errorf("plain request got %d to %q, want a redirect to https://example.com:8443/blog?page=2", rec.Code, rec.Header().Get("Location"))
+	}
+
+	// Unknown challenge tokens are answered by autocert rather than redirected, even when the
+	// challenge arrives on a port other than 80
+	req = httptest.NewRequest(http.MethodGet, "http://example.com:8080/.well-known/acme-challenge/unknown", nil)
+	rec = httptest.NewRecorder()
+	challengeServer.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown challenge got %d, want 404", rec.Code)
+	}
+}
+
+// newACMEDirectory serves just enough of an ACME CA over TLS to show whether a client
+// trusts it: the directory and nonces work, and it counts account registrations, which
+// it refuses
+func newACMEDirectory(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	var registrations atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "nonce")
+		switch r.URL.Path {
+		case "/directory":
+			json.NewEncoder(w).Encode(map[string]string{
+				"newNonce":   server.URL + "/nonce",
+				"newAccount": server.URL + "/account",
+				"newOrder":   server.URL + "/order",
+			})
+		case "/nonce":
+			w.WriteHeader(http.StatusOK)
+		default:
+			if r.URL.Path == "/account" {
+				registrations.Add(1)
+			}
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"type": "urn:ietf:params:acme:error:unauthorized", "detail": "test CA"})
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &registrations
+}
+
+func TestACMECACert(t *testing.T) {
+	for _, trusted := range []bool{true, false} {
+		server, registrations := newACMEDirectory(t)
+		flags := map[string]string{"acme-domain": "example.com", "acme-cache": t.TempDir(), "acme-directory": server.URL + "/directory"}
+		if trusted {
+			caFile := filepath.Join(t.TempDir(), "ca.pem")
+			os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+			flags["acme-ca-cert"] = caFile
+		}
+
+		tlsConfig, _, err := serverTLS(newTLSCommand(t, flags), "443")
+		if err != nil {
+			t.Fatalf("serverTLS: %v", err)
+		}
+		if _, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"}); err == nil {
+			t.Fatal("got a certificate from a CA that refuses every account")
+		}
+
+		if reached := registrations.Load() > 0; reached != trusted {
+			t.Errorf("with --acme-ca-cert %v, account registration reached the CA: %v", trusted, reached)
+		}
+	}
+}
+
+// TestACMEPebble gets a certificate from a Pebble test CA over an HTTP-01 challenge. It runs
+// only when CHOPCHOP_TEST_PEBBLE_DIRECTORY names Pebble's directory and
+// CHOPCHOP_TEST_PEBBLE_CA_CERT the certificate it serves it with. Pebble must resolve
+// CHOPCHOP_TEST_PEBBLE_DOMAIN (default chopchop.test) to this machine and find the challenge
+// server on CHOPCHOP_TEST_PEBBLE_HTTP_LISTEN (default :5002).
+func TestACMEPebble(t *testing.T) {
+	directory := os.Getenv("CHOPCHOP_TEST_PEBBLE_DIRECTORY")
+	if directory == "" {
+		t.Skip("CHOPCHOP_TEST_PEBBLE_DIRECTORY is not set")
+	}
+	caCert := os.Getenv("CHOPCHOP_TEST_PEBBLE_CA_CERT")
+	if caCert == "" {
+		t.Fatal("CHOPCHOP_TEST_PEBBLE_CA_CERT must name the certificate Pebble serves its directory with")
+	}
+	domain := os.Getenv("CHOPCHOP_TEST_PEBBLE_DOMAIN")
+	if domain == "" {
+		domain = "chopchop.test"
+	}
+	httpListen := os.Getenv("CHOPCHOP_TEST_PEBBLE_HTTP_LISTEN")
+	if httpListen == "" {
+		httpListen = ":5002"
+	}
+
+	cacheDir := t.TempDir()
+	tlsConfig, challengeServer, err := serverTLS(newTLSCommand(t, map[string]string{
+		"acme-domain":      domain,
+		"acme-cache":       cacheDir,
+		"acme-directory":   directory,
+		"acme-ca-cert":     caCert,
+		"acme-http-listen": httpListen,
+	}), "443")
+	if err != nil {
+		t.Fatalf("serverTLS: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", challengeServer.Addr)
+	if err != nil {
+		t.Fatalf("listen for challenges: %v", err)
+	}
+	go challengeServer.Serve(listener)
+	t.Cleanup(func() { challengeServer.Close() })
+
+	cert, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{ServerName: domain})
+	if err != nil {
+		t.Fatalf("get certificate from Pebble: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	if err := leaf.VerifyHostname(domain); err != nil {
+		t.Errorf("certificate from Pebble: %v", err)
+	}
+
+	// The certificate is cached, so a restarted server doesn't order a new one. Its file is
+	// named after the domain, with a suffix for RSA keys.
+	if cached, _ := filepath.Glob(filepath.Join(cacheDir, domain+"*")); len(cached) == 0 {
+		t.Errorf("certificate for %s isn't in the ACME cache %s", domain, cacheDir)
+	}
+}
@@ -0,0 +1,662 @@
+// upload.go
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Largest episode accepted by the upload API
+const maxEpisodeUploadSize = 4 << 30
+
+// Version of the tus resumable upload protocol the upload API speaks
+const tusVersion = "1.0.0"
+
+// Uploads left unfinished this long are deleted
+const staleUploadAge = 24 * time.Hour
+
+// Directory in a podcast's audio directory where uploads are staged. It is on the same file
+// system as the audio, so finished uploads can be moved into place atomically, and hidden,
+// so scans and the audio route skip it.
+const uploadStagingDir = ".uploads"
+
+// Largest metadata field accepted alongside an uploaded file
+const maxUploadFieldSize = 64 << 10
+
+// EpisodeDetails is episode metadata given with an upload. It takes precedence over the
+// tags of the audio file whenever the podcast is scanned.
+type EpisodeDetails struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Season      int    `json:"season,omitempty"`
+	Episode     int    `json:"episode,omitempty"`
+}
+
+// episodeUpload is a file being uploaded, with the metadata sent along with it
+type episodeUpload struct {
+	Podcast   string         `json:"podcast"`
+	FileName  string         `json:"fileName"`
+	Length    int64          `json:"length,omitempty"` // Size announced by tus clients
+	Details   EpisodeDetails `json:"details"`
+	Published time.Time      `json:"published,omitempty"` // Set as the file's modification time
+	Created   time.Time      `json:"created"`
+}
+
+// uploadError is an upload failure with the HTTP status it is answered with
+type uploadError struct {
+	status  int
+	message string
+}
+
+func (e *uploadError) Error() string {
+	return e.message
+}
+
+// Locks of tus uploads, so chunks of the same upload aren't written at once
+var uploadLocks sync.Map
+
+// registerUploadRoutes adds the episode upload API for admin users to the server's router
+func registerUploadRoutes(r *mux.Router, limits *abuseLimits) {
+	handle := func(path string, handler http.HandlerFunc, methods ...string) {
+		r.Handle(path, limits.limitRequests(requireAdminUser(uploadRequest(handler)))).Methods(methods...)
+	}
+
+	handle("/api/podcasts/{name}/episodes", uploadEpisode, http.MethodPost)
+	handle("/api/podcasts/{name}/uploads", createUpload, http.MethodPost)
+	handle("/api/podcasts/{name}/uploads/{id:[0-9a-f]{32}}", uploadStatus, http.MethodHead)
+	handle("/api/podcasts/{name}/uploads/{id:[0-9a-f]{32}}", uploadChunk, http.MethodPatch)
+	handle("/api/podcasts/{name}/uploads/{id:[0-9a-f]{32}}", cancelUpload, http.MethodDelete)
+
+	// tus clients discover what the server supports without credentials
+	r.HandleFunc("/api/podcasts/{name}/uploads", tusOptions).Methods(http.MethodOptions)
+	r.HandleFunc("/api/podcasts/{name}/uploads/{id:[0-9a-f]{32}}", tusOptions).Methods(http.MethodOptions)
+}
+
+// uploadRequest refuses uploads a browser sends on behalf of another site, since browsers
+// send the credentials of a signed-in admin along. Long uploads aren't cut off by
+// --read-timeout.
+func uploadRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !sameOrigin(r) || r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+			http.Error(w, "Cross-site uploads are not allowed", http.StatusForbidden)
+			return
+		}
+		http.NewResponseController(w).SetReadDeadline(time.Time{})
+		next.ServeHTTP(w, r)
+	})
+}
+
+// uploadEpisode receives an episode as multipart/form-data: the audio in a "file" field,
+// with optional title, description, season, episode and published fields
+func uploadEpisode(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	podcast, err := uploadTarget(name)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxEpisodeUploadSize+1<<20)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Send the episode as multipart/form-data", http.StatusBadRequest)
+		return
+	}
+
+	upload := episodeUpload{Podcast: name, Created: time.Now()}
+	staged := ""
+	defer func() {
+		if staged != "" {
+			os.Remove(staged)
+		}
+	}()
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, "Failed to read upload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if part.FormName() == "file" {
+			if staged != "" {
+				http.Error(w, "Upload one file at a time", http.StatusBadRequest)
+				return
+			}
+			if upload.FileName, err = uploadFileName(part.FileName()); err != nil {
+				writeUploadError(w, err)
+				return
+			}
+			if staged, err = stageUpload(podcast.AudioDir, part); err != nil {
+				writeUploadError(w, err)
+				return
+			}
+			continue
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, maxUploadFieldSize))
+		if err != nil {
+			http.Error(w, "Failed to read upload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := upload.setField(part.FormName(), string(value)); err != nil {
+			writeUploadError(w, err)
+			return
+		}
+	}
+
+	if staged == "" {
+		http.Error(w, "No file in the upload, send the audio in a field named 'file'", http.StatusBadRequest)
+		return
+	}
+
+	episode, err := publishUpload(upload, staged)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+	staged = ""
+
+	slog.Info("Episode uploaded", "podcast", name, "file", upload.FileName, "user", adminUser(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(episode)
+}
+
+// tusOptions answers tus discovery requests
+func tusOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", "creation,termination")
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(maxEpisodeUploadSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusRequest checks the protocol version of a tus request and sets the version on the response
+func tusRequest(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported tus version", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// createUpload starts a resumable upload. The client announces its size in Upload-Length
+// and the file name and episode metadata in Upload-Metadata.
+func createUpload(w http.ResponseWriter, r *http.Request) {
+	if !tusRequest(w, r) {
+		return
+	}
+	name := mux.Vars(r)["name"]
+	podcast, err := uploadTarget(name)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		http.Error(w, "Upload-Length must be the size of the file", http.StatusBadRequest)
+		return
+	}
+	if length > maxEpisodeUploadSize {
+		http.Error(w, "The file is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	upload := episodeUpload{Podcast: name, Length: length, Created: time.Now()}
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for key, value := range metadata {
+		if key == "filename" {
+			upload.FileName, err = uploadFileName(value)
+		} else {
+			err = upload.setField(key, value)
+		}
+		if err != nil {
+			writeUploadError(w, err)
+			return
+		}
+	}
+	if upload.FileName == "" {
+		http.Error(w, "Upload-Metadata must include the filename", http.StatusBadRequest)
+		return
+	}
+
+	dir, err := uploadStaging(podcast.AudioDir)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+	id := randomHex(16)
+	if err := os.WriteFile(filepath.Join(dir, id), nil, 0644); err != nil {
+		writeUploadError(w, fmt.Errorf("Failed to start upload: %v", err))
+		return
+	}
+	if err := saveUploadInfo(dir, id, upload); err != nil {
+		os.Remove(filepath.Join(dir, id))
+		writeUploadError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", r.URL.Path+"/"+id)
+	w.Header().Set("Upload-Offset", "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+// uploadStatus tells a tus client how much of an upload has arrived, so it can resume
+func uploadStatus(w http.ResponseWriter, r *http.Request) {
+	if !tusRequest(w, r) {
+		return
+	}
+	upload, dataPath, err := loadUpload(mux.Vars(r)["name"], mux.Vars(r)["id"])
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+	info, err := os.Stat(dataPath)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(info.Size(), 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+// uploadChunk appends a chunk to an upload at the offset the client says it resumes from.
+// The episode is published once the last byte arrives.
+func uploadChunk(w http.ResponseWriter, r *http.Request) {
+	if !tusRequest(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Send chunks as application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	lock, _ := uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	if !lock.(*sync.Mutex).TryLock() {
+		http.Error(w, "Another request is writing to this upload", http.StatusConflict)
+		return
+	}
+	defer lock.(*sync.Mutex).Unlock()
+
+	upload, dataPath, err := loadUpload(mux.Vars(r)["name"], id)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	file, err := os.OpenFile(dataPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		writeUploadError(w, err)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset != info.Size() {
+		file.Close()
+		http.Error(w, "Upload-Offset doesn't match the size received so far", http.StatusConflict)
+		return
+	}
+
+	// Keep whatever arrived when the connection drops, so the client can resume from there
+	written, copyErr := io.Copy(file, io.LimitReader(r.Body, upload.Length-offset))
+	closeErr := file.Close()
+	offset += written
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	if copyErr != nil || closeErr != nil {
+		slog.Warn("Upload interrupted", "podcast", upload.Podcast, "file", upload.FileName, "offset", offset, "error", errors.Join(copyErr, closeErr))
+		http.Error(w, "Upload interrupted, resume from Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	if offset < upload.Length {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	_, err = publishUpload(upload, dataPath)
+	os.Remove(dataPath + ".json")
+	uploadLocks.Delete(id)
+	if err != nil {
+		os.Remove(dataPath)
+		writeUploadError(w, err)
+		return
+	}
+
+	slog.Info("Episode uploaded", "podcast", upload.Podcast, "file", upload.FileName, "user", adminUser(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// cancelUpload deletes an unfinished upload
+func cancelUpload(w http.ResponseWriter, r *http.Request) {
+	if !tusRequest(w, r) {
+		return
+	}
+	_, dataPath, err := loadUpload(mux.Vars(r)["name"], mux.Vars(r)["id"])
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	os.Remove(dataPath)
+	os.Remove(dataPath + ".json")
+	uploadLocks.Delete(mux.Vars(r)["id"])
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publishUpload moves a finished upload into the podcast's audio directory and adds the
+// episode to the podcast, scanning only the new file
+func publishUpload(upload episodeUpload, staged string) (Episode, error) {
+	podcast, err := uploadTarget(upload.Podcast)
+	if err != nil {
+		return Episode{}, err
+	}
+	if err := checkAudioContent(staged, filepath.Ext(upload.FileName)); err != nil {
+		return Episode{}, err
+	}
+
+	target := filepath.Join(podcast.AudioDir, upload.FileName)
+	if !upload.Published.IsZero() {
+		if err := os.Chtimes(staged, time.Now(), upload.Published); err != nil {
+			return Episode{}, fmt.Errorf("Failed to set the publication date: %v", err)
+		}
+	}
+	if err := os.Chmod(staged, 0644); err != nil {
+		return Episode{}, fmt.Errorf("Failed to store upload: %v", err)
+	}
+
+	// Linking fails when the file exists, where renaming would replace an episode uploaded
+	// at the same time
+	if err := os.Link(staged, target); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return Episode{}, &uploadError{http.StatusConflict, fmt.Sprintf("%s already exists in the podcast", upload.FileName)}
+		}
+		return Episode{}, fmt.Errorf("Failed to store upload: %v", err)
+	}
+	os.Remove(staged)
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return Episode{}, err
+	}
+	episode, ok := scanAudioFile(podcast.AudioDir, podcast.BaseURL, target, info)
+	if !ok {
+		return Episode{}, fmt.Errorf("Failed to read %s", upload.FileName)
+	}
+
+	updateConfig(func() {
+		episode, err = addPodcastEpisode(upload.Podcast, episode, upload.Details)
+		if err == nil {
+			emitEvent(WebhookPayload{Event: eventPodcastRefreshed, Feed: upload.Podcast, Episodes: []Episode{episode}})
+			podcastEpisodes.WithLabelValues(upload.Podcast).Set(float64(len(config.Podcasts[upload.Podcast].Episodes)))
+		}
+	})
+	return episode, err
+}
+
+// uploadTarget returns the podcast an upload is for, which needs an audio directory
+func uploadTarget(name string) (Podcast, error) {
+	configMu.RLock()
+	podcast, exists := config.Podcasts[name]
+	configMu.RUnlock()
+	if !exists {
+		return podcast, &uploadError{http.StatusNotFound, fmt.Sprintf("Podcast '%s' does not exist", name)}
+	}
+	if podcast.AudioDir == "" {
+		return podcast, &uploadError{http.StatusConflict, fmt.Sprintf("Podcast '%s' has no audio directory to upload to", name)}
+	}
+	return podcast, nil
+}
+
+// uploadFileName checks the name an episode is uploaded under: a plain file name with the
+// extension of a supported audio format
+func uploadFileName(name string) (string, error) {
+	name = filepath.Base(strings.ReplaceAll(strings.TrimSpace(name), "\\", "/"))
+	if name == "" || name == "." || name == "/" || strings.HasPrefix(name, ".") {
+		return "", &uploadError{http.StatusBadRequest, "The upload needs a file name"}
+	}
+	if _, supported := supportedAudioExts[strings.ToLower(filepath.Ext(name))]; !supported {
+		return "", &uploadError{http.StatusUnsupportedMediaType, fmt.Sprintf("%s is not a supported audio file, use MP3, M4A, WAV, FLAC or OGG", name)}
+	}
+	return name, nil
+}
+
+// setField sets episode metadata sent with an upload
+func (u *episodeUpload) setField(key, value string) error {
+	value = strings.TrimSpace(value)
+	var err error
+	switch key {
+	case "title":
+		u.Details.Title = value
+	case "description":
+		u.Details.Description = value
+	case "season":
+		u.Details.Season, err = strconv.Atoi(value)
+	case "episode":
+		u.Details.Episode, err = strconv.Atoi(value)
+	case "published":
+		u.Published, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			u.Published, err = time.Parse(time.DateOnly, value)
+		}
+	default:
+		return nil // Ignore what we don't know, like the filetype tus clients send
+	}
+	if value != "" && err != nil {
+		return &uploadError{http.StatusBadRequest, fmt.Sprintf("Invalid %s '%s'", key, value)}
+	}
+	return nil
+}
+
+// parseUploadMetadata decodes a tus Upload-Metadata header: comma-separated keys, each
+// followed by a base64 value
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Upload-Metadata value for '%s'", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// uploadStaging returns the staging directory of an audio directory, creating it and
+// deleting uploads abandoned long ago
+func uploadStaging(audioDir string) (string, error) {
+	dir := filepath.Join(audioDir, uploadStagingDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("Failed to prepare upload, is the audio directory writable? %v", err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		// The info file of a tus upload is written once, so it ages with the data file
+		// every chunk is appended to
+		path := filepath.Join(dir, entry.Name())
+		if staleUpload(path) && staleUpload(strings.TrimSuffix(path, ".json")) {
+			os.Remove(path)
+		}
+	}
+	return dir, nil
+}
+
+// staleUpload reports whether a staged file is missing or hasn't changed in a day
+func staleUpload(path string) bool {
+	info, err := os.Stat(path)
+	return err != nil || time.Since(info.ModTime()) > staleUploadAge
+}
+
+// stageUpload writes an uploaded file to the staging directory and returns its path
+func stageUpload(audioDir string, r io.Reader) (string, error) {
+	dir, err := uploadStaging(audioDir)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp(dir, "upload-*")
+	if err != nil {
+		return "", fmt.Errorf("Failed to store upload: %v", err)
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return "", &uploadError{http.StatusRequestEntityTooLarge, "The file is too large"}
+		}
+		return "", fmt.Errorf("Failed to store upload: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("Failed to store upload: %v", err)
+	}
+	return file.Name(), nil
+}
+
+// saveUploadInfo stores the details of a resumable upload next to its data
+func saveUploadInfo(dir, id string, upload episodeUpload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, id+".json"), data); err != nil {
+		return fmt.Errorf("Failed to start upload: %v", err)
+	}
+	return nil
+}
+
+// loadUpload reads a resumable upload of a podcast, returning it and the path of its data
+func loadUpload(podcastName, id string) (episodeUpload, string, error) {
+	var upload episodeUpload
+	podcast, err := uploadTarget(podcastName)
+	if err != nil {
+		return upload, "", err
+	}
+
+	dataPath := filepath.Join(podcast.AudioDir, uploadStagingDir, id)
+	data, err := os.ReadFile(dataPath + ".json")
+	if err == nil {
+		err = json.Unmarshal(data, &upload)
+	}
+	if err != nil || upload.Podcast != podcastName {
+		return upload, "", &uploadError{http.StatusNotFound, "Upload not found"}
+	}
+	return upload, dataPath, nil
+}
+
+// writeUploadError answers a failed upload with the status of the error
+func writeUploadError(w http.ResponseWriter, err error) {
+	var failure *uploadError
+	if errors.As(err, &failure) {
+		http.Error(w, failure.message, failure.status)
+		return
+	}
+	slog.Warn("Upload failed", "error", err)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// checkAudioContent checks that a file starts like the audio format its extension names,
+// so anything else renamed to .mp3 isn't published
+func checkAudioContent(path, ext string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	head := make([]byte, 12)
+	n, _ := io.ReadFull(file, head)
+	head = head[:n]
+
+	valid := false
+	switch strings.ToLower(ext) {
+	case ".mp3":
+		valid = bytes.HasPrefix(head, []byte("ID3")) || (len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0)
+	case ".m4a":
+		valid = len(head) >= 8 && string(head[4:8]) == "ftyp"
+	case ".wav":
+		valid = len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WAVE"
+	case ".flac":
+		valid = bytes.HasPrefix(head, []byte("fLaC")) || bytes.HasPrefix(head, []byte("ID3"))
+	case ".ogg":
+		valid = bytes.HasPrefix(head, []byte("OggS"))
+	}
+	if !valid {
+		return &uploadError{http.StatusUnsupportedMediaType, fmt.Sprintf("The file is not %s audio", strings.ToUpper(strings.TrimPrefix(ext, ".")))}
+	}
+	return nil
+}
+
+// episodeFileKey returns the path of an episode's file relative to the audio directory,
+// which uploaded details are stored under
+func episodeFileKey(podcast Podcast, episode Episode) string {
+	rel, err := filepath.Rel(podcast.AudioDir, episode.FilePath)
+	if err != nil {
+		return episode.FilePath
+	}
+	return filepath.ToSlash(rel)
+}
+
+// applyEpisodeDetails overrides the scanned metadata of an episode with details uploaded
+// with its file
+func applyEpisodeDetails(podcast Podcast, episode Episode) Episode {
+	details, exists := podcast.EpisodeDetails[episodeFileKey(podcast, episode)]
+	if !exists {
+		return episode
+	}
+	// Scanned titles and descriptions are escaped the same way
+	if details.Title != "" {
+		episode.Title = html.EscapeString(details.Title)
+	}
+	if details.Description != "" {
+		episode.Description = html.EscapeString(details.Description)
+	}
+	if details.Season != 0 {
+		episode.Season = details.Season
+	}
+	if details.Episode != 0 {
+		episode.Episode = details.Episode
+	}
+	return episode
+}
@@ -0,0 +1,519 @@
+// webhooks.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Webhook is an HTTP endpoint notified when content changes
+type Webhook struct {
+	URL     string    `json:"url"`
+	Secret  string    `json:"secret"`           // Key for the HMAC-SHA256 payload signature
+	Events  []string  `json:"events,omitempty"` // Events to deliver, all events when empty
+	Created time.Time `json:"created"`
+}
+
+// Webhook events
+const (
+	eventEntryCreated     = "entry.created"
+	eventEntryUpdated     = "entry.updated"
+	eventEntryDeleted     = "entry.deleted"
+	eventPodcastRefreshed = "podcast.refreshed"
+	eventFeedCreated      = "feed.created"
+	eventFeedDeleted      = "feed.deleted"
+)
+
+var webhookEvents = []string{eventEntryCreated, eventEntryUpdated, eventEntryDeleted, eventPodcastRefreshed, eventFeedCreated, eventFeedDeleted}
+
+// Delivery attempts per event and the delay before the first retry, doubled on each retry
+const (
+	webhookAttempts     = 5
+	webhookInitialDelay = time.Second
+)
+
+// How long commands wait for their webhook deliveries before leaving them to the server
+const cliWebhookWait = 10 * time.Second
+
+// How often the server retries deliveries queued by commands and earlier shutdowns
+const webhookRetryInterval = time.Minute
+
+// WebhookPayload is the JSON body posted to webhook targets
+type WebhookPayload struct {
+	ID       string    `json:"id"`
+	Event    string    `json:"event"`
+	Time     time.Time `json:"time"`
+	Feed     string    `json:"feed,omitempty"`
+	Kind     string    `json:"kind,omitempty"` // feed or podcast, for feed events
+	Entry    *Item     `json:"entry,omitempty"`
+	Episodes []Episode `json:"episodes,omitempty"`
+}
+
+// WebhookDelivery is one delivery attempt, as recorded in the delivery log
+type WebhookDelivery struct {
+	Time     time.Time `json:"time"`
+	ID       string    `json:"id"`
+	Event    string    `json:"event"`
+	URL      string    `json:"url"`
+	Attempt  int       `json:"attempt"`
+	Status   int       `json:"status,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Duration string    `json:"duration"`
+}
+
+// QueuedDelivery is a webhook delivery that hadn't succeeded when its process exited,
+// kept in the delivery queue for the server to retry
+type QueuedDelivery struct {
+	URL     string         `json:"url"`
+	Payload WebhookPayload `json:"payload"`
+	Queued  time.Time      `json:"queued"`
+}
+
+var (
+	webhookClient     = &http.Client{Timeout: 15 * time.Second}
+	pendingDeliveries sync.WaitGroup // Outgoing webhook and WebSub requests still in flight
+	webhookLogMu      sync.Mutex
+
+	// Webhook deliveries in flight, by event ID and URL, queued if the process exits first
+	unfinishedMu         sync.Mutex
+	unfinishedDeliveries = make(map[string]QueuedDelivery)
+)
+
+// webhookLogPath returns the path of the delivery log, next to the config file
+func webhookLogPath() string {
+	return filepath.Join(filepath.Dir(cfgFile), "webhook-deliveries.log")
+}
+
+// webhookQueuePath returns the path of the queue of deliveries for the server to retry
+func webhookQueuePath() string {
+	return filepath.Join(filepath.Dir(cfgFile), "webhook-queue.jsonl")
+}
+
+// emitItemEvents sends entry.created and entry.updated events for a feed
+func emitItemEvents(feedName string, added, updated []Item) {
+	for i := range added {
+		emitEvent(WebhookPayload{Event: eventEntryCreated, Feed: feedName, Entry: &added[i]})
+	}
+	for i := range updated {
+		emitEvent(WebhookPayload{Event: eventEntryUpdated, Feed: feedName, Entry: &updated[i]})
+	}
+}
+
+// emitFeedEvent sends a feed.created or feed.deleted event
+func emitFeedEvent(event, name, kind string) {
+	emitEvent(WebhookPayload{Event: event, Feed: name, Kind: kind})
+}
+
+// emitEvent delivers a payload to every webhook subscribed to its event in the background
+// and publishes the changed feed to its WebSub hub. Callers running inside the server must
+// hold configMu; the CLI waits briefly for deliveries before exiting (see finishWebhooks).
+func emitEvent(payload WebhookPayload) {
+	payload.ID = newDeliveryID()
+	payload.Time = time.Now().UTC()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Failed to encode webhook payload", "error", err)
+		return
+	}
+
+	for _, webhook := range config.Webhooks {
+		if !webhook.subscribed(payload.Event) {
+			continue
+		}
+		pendingDeliveries.Add(1)
+		go func(webhook Webhook) {
+			defer pendingDeliveries.Done()
+			deliverWebhook(webhook, payload, body)
+		}(webhook)
+	}
+
+	if payload.Feed != "" && payload.Event != eventFeedDeleted {
+		publishWebSub(payload.Feed)
+	}
+}
+
+// finishWebhooks gives the deliveries triggered by a command a short while to finish and
+// queues the webhook deliveries that haven't for the server to retry
+func finishWebhooks() {
+	if waitForWebhooksTimeout(cliWebhookWait) {
+		return
+	}
+	if queued := queueUnfinishedDeliveries(); queued > 0 {
+		fmt.Printf("%d webhook deliveries haven't succeeded yet, queued for the server to retry\n", queued)
+	}
+}
+
+// waitForWebhooksTimeout is waitForWebhooks with a deadline. It reports whether all
+// deliveries finished in time.
+func waitForWebhooksTimeout(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		pendingDeliveries.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// subscribed reports whether the webhook wants the given event
+func (webhook Webhook) subscribed(event string) bool {
+	if len(webhook.Events) == 0 {
+		return true
+	}
+	for _, e := range webhook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// deliverWebhook posts a payload, retrying with exponential backoff on network errors,
+// 429 and 5xx responses
+func deliverWebhook(webhook Webhook, payload WebhookPayload, body []byte) {
+	key := payload.ID + " " + webhook.URL
+	unfinishedMu.Lock()
+	unfinishedDeliveries[key] = QueuedDelivery{URL: webhook.URL, Payload: payload}
+	unfinishedMu.Unlock()
+	defer func() {
+		unfinishedMu.Lock()
+		delete(unfinishedDeliveries, key)
+		unfinishedMu.Unlock()
+	}()
+
+	delay := webhookInitialDelay
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		start := time.Now()
+		status, err := postWebhook(webhook, payload, body)
+
+		delivery := WebhookDelivery{
+			Time:     start.UTC(),
+			ID:       payload.ID,
+			Event:    payload.Event,
+			URL:      webhook.URL,
+			Attempt:  attempt,
+			Status:   status,
+			Duration: time.Since(start).Round(time.Millisecond).String(),
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		logWebhookDelivery(delivery)
+
+		retryable := err != nil || status == http.StatusTooManyRequests || status >= 500
+		if !retryable {
+			if status >= 300 {
+				slog.Warn("Webhook rejected event", "url", webhook.URL, "event", payload.Event, "status", status)
+			}
+			return
+		}
+		if attempt < webhookAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	slog.Error("Giving up delivering webhook event", "url", webhook.URL, "event", payload.Event, "attempts", webhookAttempts)
+}
+
+// postWebhook sends one signed request and returns the response status
+func postWebhook(webhook Webhook, payload WebhookPayload, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ChopChopRSS")
+	req.Header.Set("X-ChopChop-Event", payload.Event)
+	req.Header.Set("X-ChopChop-Delivery", payload.ID)
+	req.Header.Set("X-ChopChop-Signature", "sha256="+signWebhookBody(webhook.Secret, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// signWebhookBody returns the hex HMAC-SHA256 of a payload
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// logWebhookDelivery appends a delivery attempt to the delivery log
+func logWebhookDelivery(delivery WebhookDelivery) {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return
+	}
+
+	webhookLogMu.Lock()
+	defer webhookLogMu.Unlock()
+
+	path := webhookLogPath()
+	if err := rotateLog(path); err != nil {
+		slog.Error("Failed to rotate webhook delivery log", "error", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Error("Failed to open webhook delivery log", "error", err)
+		return
+	}
+	defer file.Close()
+
+	file.Write(append(data, '\n'))
+}
+
+// queueUnfinishedDeliveries appends the webhook deliveries still in flight to the delivery
+// queue and returns how many were queued
+func queueUnfinishedDeliveries() int {
+	unfinishedMu.Lock()
+	var lines []byte
+	queued := 0
+	for _, delivery := range unfinishedDeliveries {
+		delivery.Queued = time.Now().UTC()
+		data, err := json.Marshal(delivery)
+		if err != nil {
+			continue
+		}
+		lines = append(append(lines, data...), '\n')
+		queued++
+	}
+	unfinishedMu.Unlock()
+	if queued == 0 {
+		return 0
+	}
+
+	webhookLogMu.Lock()
+	defer webhookLogMu.Unlock()
+
+	file, err := os.OpenFile(webhookQueuePath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Error("Failed to queue webhook deliveries", "error", err)
+		return 0
+	}
+	defer file.Close()
+
+	if _, err := file.Write(lines); err != nil {
+		slog.Error("Failed to queue webhook deliveries", "error", err)
+		return 0
+	}
+	return queued
+}
+
+// retryQueuedWebhooks delivers queued webhook events now and on every retry interval
+// until ctx is done
+func retryQueuedWebhooks(ctx context.Context) {
+	ticker := time.NewTicker(webhookRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		deliverQueuedWebhooks()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliverQueuedWebhooks takes the delivery queue and delivers each event again, signed
+// with the current secret of its webhook. Events for webhooks that were deleted are dropped.
+func deliverQueuedWebhooks() {
+	// Move the queue aside first, so commands queueing meanwhile start a new one
+	path := webhookQueuePath()
+	retrying := path + ".retrying"
+	if _, err := os.Stat(retrying); os.IsNotExist(err) {
+		if err := os.Rename(path, retrying); err != nil {
+			return
+		}
+	}
+
+	data, err := os.ReadFile(retrying)
+	if err != nil {
+		slog.Error("Failed to read webhook delivery queue", "error", err)
+		return
+	}
+	os.Remove(retrying)
+
+	configMu.RLock()
+	webhooks := config.Webhooks
+	configMu.RUnlock()
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		var delivery QueuedDelivery
+		if err := json.Unmarshal(line, &delivery); err != nil {
+			continue
+		}
+		index := slices.IndexFunc(webhooks, func(webhook Webhook) bool { return webhook.URL == delivery.URL })
+		if index < 0 {
+			continue
+		}
+		body, err := json.Marshal(delivery.Payload)
+		if err != nil {
+			continue
+		}
+
+		slog.Info("Retrying queued webhook delivery", "url", delivery.URL, "event", delivery.Payload.Event, "queued", delivery.Queued)
+		pendingDeliveries.Add(1)
+		go func(webhook Webhook) {
+			defer pendingDeliveries.Done()
+			deliverWebhook(webhook, delivery.Payload, body)
+		}(webhooks[index])
+	}
+}
+
+// newDeliveryID returns a random identifier for an event
+func newDeliveryID() string {
+	return randomHex(16)
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		fatal("Failed to generate random bytes", "error", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// addWebhook registers a new webhook target
+func addWebhook(cmd *cobra.Command, args []string) {
+	targetURL, _ := cmd.Flags().GetString("url")
+	secret, _ := cmd.Flags().GetString("secret")
+	events, _ := cmd.Flags().GetStringSlice("events")
+
+	for _, event := range events {
+		known := false
+		for _, e := range webhookEvents {
+			known = known || e == event
+		}
+		if !known {
+			fmt.Printf("Unknown event '%s'. Valid events: %s\n", event, strings.Join(webhookEvents, ", "))
+			return
+		}
+	}
+
+	generated := secret == ""
+	if generated {
+		secret = randomHex(32)
+	}
+
+	config.Webhooks = append(config.Webhooks, Webhook{
+		URL:     targetURL,
+		Secret:  secret,
+		Events:  events,
+		Created: time.Now(),
+	})
+
+	saveConfig()
+	fmt.Printf("Webhook [%d] added for %s\n", len(config.Webhooks)-1, targetURL)
+	if generated {
+		fmt.Printf("Signing secret: %s\n", secret)
+	}
+}
+
+// listWebhooks lists configured webhook targets
+func listWebhooks(cmd *cobra.Command, args []string) {
+	if len(config.Webhooks) == 0 {
+		fmt.Println("No webhooks configured")
+		return
+	}
+
+	fmt.Println("Webhooks:")
+	for i, webhook := range config.Webhooks {
+		events := "all events"
+		if len(webhook.Events) > 0 {
+			events = strings.Join(webhook.Events, ", ")
+		}
+		fmt.Printf("[%d] %s (%s)\n", i, webhook.URL, events)
+	}
+}
+
+// deleteWebhook removes a webhook target
+func deleteWebhook(cmd *cobra.Command, args []string) {
+	index, _ := cmd.Flags().GetInt("index")
+
+	if index < 0 || index >= len(config.Webhooks) {
+		fmt.Printf("Invalid webhook index: %d. Valid range: 0-%d\n", index, len(config.Webhooks)-1)
+		return
+	}
+
+	targetURL := config.Webhooks[index].URL
+	config.Webhooks = append(config.Webhooks[:index], config.Webhooks[index+1:]...)
+
+	saveConfig()
+	fmt.Printf("Webhook %s deleted\n", targetURL)
+}
+
+// webhookLog prints the most recent delivery attempts
+func webhookLog(cmd *cobra.Command, args []string) {
+	limit, _ := cmd.Flags().GetInt("limit")
+
+	// Read the rotated log first, so the newest deliveries come last
+	var deliveries []WebhookDelivery
+	found := false
+	for _, path := range []string{webhookLogPath() + ".1", webhookLogPath()} {
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Failed to open webhook delivery log: %v\n", err)
+			return
+		}
+		found = true
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var delivery WebhookDelivery
+			if err := json.Unmarshal(scanner.Bytes(), &delivery); err != nil {
+				continue
+			}
+			deliveries = append(deliveries, delivery)
+			if limit > 0 && len(deliveries) > limit {
+				deliveries = deliveries[1:]
+			}
+		}
+		file.Close()
+	}
+	if !found {
+		fmt.Println("No webhook deliveries yet")
+		return
+	}
+
+	for _, d := range deliveries {
+		result := fmt.Sprintf("status %d", d.Status)
+		if d.Error != "" {
+			result = "error: " + d.Error
+		}
+		fmt.Printf("%s %s %s attempt %d -> %s (%s) [%s]\n",
+			d.Time.Local().Format("2006-01-02 15:04:05"), d.Event, d.URL, d.Attempt, result, d.Duration, d.ID)
+	}
+}
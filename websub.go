@@ -0,0 +1,453 @@
+// websub.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// WebSubConfig controls how feeds advertise and notify a WebSub hub
+type WebSubConfig struct {
+	PublicURL string `json:"publicUrl"`         // Public base URL of the server, used for feed topic URLs
+	Hub       string `json:"hub,omitempty"`     // External hub to ping on changes
+	Builtin   bool   `json:"builtin,omitempty"` // Act as the hub at /websub instead
+}
+
+// WebSubSubscription is a verified subscription to the built-in hub
+type WebSubSubscription struct {
+	Topic    string    `json:"topic"`
+	Callback string    `json:"callback"`
+	Secret   string    `json:"secret,omitempty"`
+	Expires  time.Time `json:"expires"`
+	Created  time.Time `json:"created"`
+}
+
+// Lease limits for built-in hub subscriptions
+const (
+	defaultLeaseSeconds = 10 * 24 * 60 * 60
+	maxLeaseSeconds     = 30 * 24 * 60 * 60
+)
+
+// Delay before publishing, so a burst of changes from one command results in one notification
+const websubPublishDelay = time.Second
+
+var (
+	websubClient    = &http.Client{Timeout: 15 * time.Second}
+	websubMu        sync.Mutex // Guards the subscriptions file and websubScheduled
+	websubScheduled = make(map[string]bool)
+)
+
+// websubHubURL returns the hub feeds should advertise, or "" when WebSub is off.
+// Like the topic URL helpers below, callers running inside the server must hold configMu.
+func websubHubURL() string {
+	if config.WebSub == nil {
+		return ""
+	}
+	if config.WebSub.Builtin {
+		return strings.TrimSuffix(config.WebSub.PublicURL, "/") + "/websub"
+	}
+	return config.WebSub.Hub
+}
+
+// feedTopicURL returns the public URL of a feed, or "" when WebSub is off or the feed is
+// private or access-restricted
+func feedTopicURL(feedName string) string {
+	if config.WebSub == nil || config.WebSub.PublicURL == "" || restrictedFeed(config.Feeds[feedName]) {
+		return ""
+	}
+	return strings.TrimSuffix(config.WebSub.PublicURL, "/") + "/" + feedName
+}
+
+// podcastTopicURL returns the public URL of a podcast feed, or "" when WebSub is off
+// or the podcast is private or access-restricted
+func podcastTopicURL(podcastName string) string {
+	if config.WebSub == nil || restrictedPodcast(config.Podcasts[podcastName]) {
+		return ""
+	}
+	return config.Podcasts[podcastName].BaseURL
+}
+
+// setWebSubHeaders adds the hub and self Link headers to a feed response
+func setWebSubHeaders(w http.ResponseWriter, hub, topic string) {
+	if hub == "" || topic == "" {
+		return
+	}
+	w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="hub"`, hub))
+	w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="self"`, topic))
+}
+
+// addWebSubLinks adds atom:link hub and self elements to an RSS channel
+func addWebSubLinks(rss, hub, topic string) string {
+	if hub == "" || topic == "" {
+		return rss
+	}
+
+	rss = strings.Replace(rss, `<rss version="2.0"`,
+		`<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"`, 1)
+
+	channelStart := strings.Index(rss, "<channel>")
+	if channelStart == -1 {
+		return rss
+	}
+	insertPos := channelStart + len("<channel>")
+
+	links := fmt.Sprintf("\n    <atom:link rel=\"hub\" href=\"%s\" />\n    <atom:link rel=\"self\" href=\"%s\" />",
+		html.EscapeString(hub), html.EscapeString(topic))
+	return rss[:insertPos] + links + rss[insertPos:]
+}
+
+// publishWebSub notifies the hub that a feed or podcast changed, along with any
+// composite feeds that include it. Notifications are sent in the background.
+// Callers running inside the server must hold configMu.
+func publishWebSub(name string) {
+	if websubHubURL() == "" {
+		return
+	}
+
+	var topics []string
+	if _, exists := config.Podcasts[name]; exists {
+		topics = append(topics, podcastTopicURL(name))
+	}
+	if _, exists := config.Feeds[name]; exists {
+		topics = append(topics, feedTopicURL(name))
+		for compositeName, feed := range config.Feeds {
+			if feed.Composite == nil {
+				continue
+			}
+			for _, member := range feed.Composite.Members {
+				if member.Feed == name {
+					topics = append(topics, feedTopicURL(compositeName))
+					break
+				}
+			}
+		}
+	}
+
+	for _, topic := range topics {
+		scheduleWebSubPublish(topic)
+	}
+}
+
+// scheduleWebSubPublish publishes a topic after a short delay, coalescing repeated changes
+func scheduleWebSubPublish(topic string) {
+	websubMu.Lock()
+	defer websubMu.Unlock()
+
+	if topic == "" || websubScheduled[topic] {
+		return
+	}
+	websubScheduled[topic] = true
+
+	pendingDeliveries.Add(1)
+	go func() {
+		defer pendingDeliveries.Done()
+		time.Sleep(websubPublishDelay)
+
+		websubMu.Lock()
+		delete(websubScheduled, topic)
+		websubMu.Unlock()
+
+		configMu.RLock()
+		builtin := config.WebSub != nil && config.WebSub.Builtin
+		hub := websubHubURL()
+		configMu.RUnlock()
+
+		if builtin {
+			distributeWebSub(topic)
+			return
+		}
+		if err := pingWebSubHub(hub, topic); err != nil {
+			slog.Warn("Failed to ping WebSub hub", "hub", hub, "topic", topic, "error", err)
+		}
+	}()
+}
+
+// pingWebSubHub tells an external hub that a topic has new content
+func pingWebSubHub(hub, topic string) error {
+	form := url.Values{
+		"hub.mode":  {"publish"},
+		"hub.url":   {topic},
+		"hub.topic": {topic},
+	}
+	resp, err := websubClient.PostForm(hub, form)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// resolveWebSubTopic renders the current content of one of our topics
+func resolveWebSubTopic(topic string) (string, error) {
+	configMu.RLock()
+	var feedName, podcastName string
+	for name := range config.Feeds {
+		if feedTopicURL(name) == topic {
+			feedName = name
+		}
+	}
+	for name := range config.Podcasts {
+		if podcastTopicURL(name) == topic {
+			podcastName = name
+		}
+	}
+	configMu.RUnlock()
+
+	switch {
+	case feedName != "":
+		return renderRSSFeed(feedName)
+	case podcastName != "":
+		return renderPodcastFeed(podcastName, nil)
+	}
+	return "", errFeedNotFound
+}
+
+// distributeWebSub pushes the current content of a topic to every active subscriber
+func distributeWebSub(topic string) {
+	content, err := resolveWebSubTopic(topic)
+	if err != nil {
+		slog.Error("Failed to render WebSub topic", "topic", topic, "error", err)
+		return
+	}
+
+	configMu.RLock()
+	hub := websubHubURL()
+	configMu.RUnlock()
+
+	for _, sub := range activeSubscriptions(topic) {
+		req, err := http.NewRequest(http.MethodPost, sub.Callback, strings.NewReader(content))
+		if err != nil {
+			continue
+		}
+		req.Header.Set("Content-Type", "application/rss+xml")
+		req.Header.Add("Link", fmt.Sprintf(`<%s>; rel="hub"`, hub))
+		req.Header.Add("Link", fmt.Sprintf(`<%s>; rel="self"`, topic))
+		if sub.Secret != "" {
+			req.Header.Set("X-Hub-Signature", "sha256="+signWebhookBody(sub.Secret, []byte(content)))
+		}
+
+		resp, err := websubClient.Do(req)
+		if err != nil {
+			slog.Warn("Failed to deliver to WebSub subscriber", "topic", topic, "callback", sub.Callback, "error", err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			slog.Warn("WebSub subscriber rejected update", "topic", topic, "callback", sub.Callback, "status", resp.StatusCode)
+		}
+	}
+}
+
+// websubSubscriptionsPath returns the path of the subscription store, next to the config file
+func websubSubscriptionsPath() string {
+	return filepath.Join(filepath.Dir(cfgFile), "websub-subscriptions.json")
+}
+
+// loadSubscriptions reads the subscription store, dropping expired leases.
+// Callers must hold websubMu.
+func loadSubscriptions() []WebSubSubscription {
+	data, err := os.ReadFile(websubSubscriptionsPath())
+	if err != nil {
+		return nil
+	}
+
+	var subs []WebSubSubscription
+	if err := json.Unmarshal(data, &subs); err != nil {
+		slog.Warn("Failed to parse WebSub subscriptions", "error", err)
+		return nil
+	}
+
+	now := time.Now()
+	active := subs[:0]
+	for _, sub := range subs {
+		if sub.Expires.After(now) {
+			active = append(active, sub)
+		}
+	}
+	return active
+}
+
+// saveSubscriptions writes the subscription store. Callers must hold websubMu.
+func saveSubscriptions(subs []WebSubSubscription) {
+	data, err := json.MarshalIndent(subs, "", "  ")
+	if err != nil {
+		slog.Error("Failed to marshal WebSub subscriptions", "error", err)
+		return
+	}
+	// Subscriptions carry their callbacks' secrets, so only the owner may read them
+	path := websubSubscriptionsPath()
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		slog.Error("Failed to write WebSub subscriptions", "error", err)
+		return
+	}
+	os.Chmod(path, 0600) // WriteFile keeps the mode of an existing file
+}
+
+// activeSubscriptions returns the unexpired subscriptions to a topic
+func activeSubscriptions(topic string) []WebSubSubscription {
+	websubMu.Lock()
+	defer websubMu.Unlock()
+
+	var subs []WebSubSubscription
+	for _, sub := range loadSubscriptions() {
+		if sub.Topic == topic {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// handleWebSubHub implements the subscriber side of the built-in hub:
+// subscription requests are accepted, then verified asynchronously
+func handleWebSubHub(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	mode := r.PostForm.Get("hub.mode")
+	topic := r.PostForm.Get("hub.topic")
+	callback := r.PostForm.Get("hub.callback")
+	secret := r.PostForm.Get("hub.secret")
+
+	if mode != "subscribe" && mode != "unsubscribe" {
+		http.Error(w, "hub.mode must be subscribe or unsubscribe", http.StatusBadRequest)
+		return
+	}
+	if callbackURL, err := url.Parse(callback); err != nil || (callbackURL.Scheme != "http" && callbackURL.Scheme != "https") {
+		http.Error(w, "hub.callback must be an http(s) URL", http.StatusBadRequest)
+		return
+	}
+	if _, err := resolveWebSubTopic(topic); err != nil {
+		http.Error(w, "unknown hub.topic", http.StatusNotFound)
+		return
+	}
+	if len(secret) > 200 {
+		http.Error(w, "hub.secret is too long", http.StatusBadRequest)
+		return
+	}
+
+	lease := defaultLeaseSeconds
+	if value := r.PostForm.Get("hub.lease_seconds"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			lease = min(n, maxLeaseSeconds)
+		}
+	}
+
+	sub := WebSubSubscription{
+		Topic:    topic,
+		Callback: callback,
+		Secret:   secret,
+		Expires:  time.Now().Add(time.Duration(lease) * time.Second),
+		Created:  time.Now(),
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+
+	pendingDeliveries.Add(1)
+	go func() {
+		defer pendingDeliveries.Done()
+		verifyWebSubIntent(mode, sub, lease)
+	}()
+}
+
+// verifyWebSubIntent confirms a (un)subscription with the subscriber before storing it
+func verifyWebSubIntent(mode string, sub WebSubSubscription, lease int) {
+	challenge := randomHex(16)
+
+	query := url.Values{
+		"hub.mode":      {mode},
+		"hub.topic":     {sub.Topic},
+		"hub.challenge": {challenge},
+	}
+	if mode == "subscribe" {
+		query.Set("hub.lease_seconds", strconv.Itoa(lease))
+	}
+
+	verifyURL := sub.Callback
+	if strings.Contains(verifyURL, "?") {
+		verifyURL += "&" + query.Encode()
+	} else {
+		verifyURL += "?" + query.Encode()
+	}
+
+	resp, err := websubClient.Get(verifyURL)
+	if err != nil {
+		slog.Warn("WebSub verification failed", "mode", mode, "callback", sub.Callback, "error", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode >= 300 || !bytes.Equal(bytes.TrimSpace(body), []byte(challenge)) {
+		slog.Warn("WebSub request not confirmed by subscriber", "mode", mode, "topic", sub.Topic, "callback", sub.Callback)
+		return
+	}
+
+	websubMu.Lock()
+	defer websubMu.Unlock()
+
+	subs := loadSubscriptions()
+	kept := subs[:0]
+	for _, existing := range subs {
+		if existing.Topic != sub.Topic || existing.Callback != sub.Callback {
+			kept = append(kept, existing)
+		}
+	}
+	if mode == "subscribe" {
+		kept = append(kept, sub)
+	}
+	saveSubscriptions(kept)
+
+	slog.Info("WebSub request confirmed", "mode", mode, "topic", sub.Topic, "callback", sub.Callback)
+}
+
+// configureWebSub sets up hub advertisement and publishing
+func configureWebSub(cmd *cobra.Command, args []string) {
+	publicURL, _ := cmd.Flags().GetString("public-url")
+	hub, _ := cmd.Flags().GetString("hub")
+	builtin, _ := cmd.Flags().GetBool("builtin")
+	disable, _ := cmd.Flags().GetBool("disable")
+
+	if disable {
+		config.WebSub = nil
+		saveConfig()
+		fmt.Println("WebSub disabled")
+		return
+	}
+
+	if publicURL == "" {
+		fmt.Println("--public-url is required to enable WebSub")
+		return
+	}
+	if (hub == "") == !builtin {
+		fmt.Println("Use either --hub <url> for an external hub or --builtin for the built-in hub")
+		return
+	}
+
+	config.WebSub = &WebSubConfig{PublicURL: publicURL, Hub: hub, Builtin: builtin}
+	saveConfig()
+	fmt.Printf("WebSub enabled, feeds advertise hub %s\n", websubHubURL())
+}